@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Krognol/thronebot/internal"
+	"github.com/bwmarrin/discordgo"
+)
+
+// envPrefix is the prefix of environment variables which override config fields and secrets.
+// A config field's variable is the prefix followed by its upper case JSON name, ex. `THRONEBOT_WEEKLY_VOTING`.
+const envPrefix = "THRONEBOT_"
+
+type config struct {
+	ArchiveRepo      string `json:"archive_repo"`
+	ArchiveDir       string `json:"archive_dir,omitempty"`
+	ArchiveThreshold int    `json:"archive_threshold,omitempty"`
+	ArchiveKeep      int    `json:"archive_keep,omitempty"`
+	ArchiveFormat    string `json:"archive_format,omitempty"`
+	ArchiveMirror    bool   `json:"archive_mirror,omitempty"`
+	MirrorMaxSize    int    `json:"mirror_max_size_mb,omitempty"`
+	MirrorMaxTotal   int    `json:"mirror_max_total_mb,omitempty"`
+	DatabasePath     string `json:"database_path"`
+	DatabaseDriver   string `json:"database_driver,omitempty"`
+	LogPath          string `json:"log_path"`
+	WeeklySuggestion string `json:"weekly_suggestion"`
+	WeeklyVoting     string `json:"weekly_voting"`
+	Staff            string `json:"staff"`
+	WeeklyCycleDay   string `json:"weekly_cycle_day"`
+	WeeklyCycleTime  string `json:"weekly_cycle_time"`
+	WeeklyCooldown   int    `json:"weekly_cooldown"`
+	StaffChannel     string `json:"staff_channel"`
+	GameDataPath     string `json:"game_data_path"`
+	Prefix           string `json:"prefix,omitempty"`
+	ArchiveChannel   string `json:"archive_channel,omitempty"`
+	SuggestionLimit  *int   `json:"suggestion_limit,omitempty"`
+	BackupDir        string `json:"backup_dir,omitempty"`
+	BackupInterval   string `json:"backup_interval,omitempty"`
+	BackupKeep       int    `json:"backup_keep,omitempty"`
+
+	Permissions internal.Permissions `json:"permissions"`
+}
+
+// cfgMu guards the config while it's changed, saved or reloaded at runtime
+var cfgMu sync.Mutex
+
+// permissions returns the permission config with the default owner applied.
+// The legacy staff role is the default of the staff_role guild setting.
+func (cfg *config) permissions() *internal.Permissions {
+	p := cfg.Permissions
+	if len(p.Owners) == 0 {
+		p.Owners = []string{"95957677376540672"}
+	}
+	return &p
+}
+
+// guildDefaults returns the settings of guilds which haven't changed them.
+// Guilds may make 3 suggestions a week unless suggestion_limit is set, where 0 disables suggestions.
+func (cfg *config) guildDefaults() internal.GuildSettings {
+	gs := internal.GuildSettings{
+		Prefix:            cfg.Prefix,
+		StaffRole:         cfg.Staff,
+		StaffChannel:      cfg.StaffChannel,
+		SuggestionChannel: cfg.WeeklySuggestion,
+		VotingChannel:     cfg.WeeklyVoting,
+		ArchiveChannel:    cfg.ArchiveChannel,
+		SuggestionLimit:   3,
+		WeeklyCooldown:    cfg.WeeklyCooldown,
+	}
+
+	if gs.Prefix == "" {
+		gs.Prefix = "thronebot"
+	}
+
+	if cfg.SuggestionLimit != nil {
+		gs.SuggestionLimit = *cfg.SuggestionLimit
+	}
+	return gs
+}
+
+// setGuildDefaults is the reverse of guildDefaults
+func (cfg *config) setGuildDefaults(gs internal.GuildSettings) {
+	cfg.Prefix = gs.Prefix
+	cfg.Staff = gs.StaffRole
+	cfg.StaffChannel = gs.StaffChannel
+	cfg.WeeklySuggestion = gs.SuggestionChannel
+	cfg.WeeklyVoting = gs.VotingChannel
+	cfg.ArchiveChannel = gs.ArchiveChannel
+	limit := gs.SuggestionLimit
+	cfg.SuggestionLimit = &limit
+	cfg.WeeklyCooldown = gs.WeeklyCooldown
+}
+
+// save writes the config to path. It writes to a temporary file first and renames it
+// over the old config, so a crash mid-write can't leave a truncated config behind.
+// Fields overridden by environment variables keep the value they have in the file.
+func (cfg *config) save(path string) error {
+	out := *cfg
+	if b, err := os.ReadFile(path); err == nil {
+		onDisk := new(config)
+		if json.Unmarshal(b, onDisk) == nil {
+			src := reflect.ValueOf(onDisk).Elem()
+			dst := reflect.ValueOf(&out).Elem()
+			eachEnvField(dst, func(i int, _, _ string) error {
+				dst.Field(i).Set(src.Field(i))
+				return nil
+			})
+		}
+	}
+
+	b, err := json.MarshalIndent(&out, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if fi, err := os.Stat(path); err == nil {
+		f.Chmod(fi.Mode())
+	}
+
+	if _, err = f.Write(append(b, '\n')); err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// schedule returns when the weekly cycle runs, defaulting to monday 00:00 UTC
+func (cfg *config) schedule() (time.Weekday, int, int, error) {
+	day, clock := cfg.WeeklyCycleDay, cfg.WeeklyCycleTime
+	if day == "" {
+		day = "monday"
+	}
+
+	if clock == "" {
+		clock = "00:00"
+	}
+	return internal.ParseSchedule(day, clock)
+}
+
+// backups returns the database backup settings. Backups go to `backups` and the 7 newest are kept unless
+// configured otherwise, where a backup_keep of -1 keeps every backup. Scheduled backups only run if
+// backup_interval is set, ex. `24h`.
+func (cfg *config) backups() (*internal.Backups, error) {
+	b := &internal.Backups{
+		Path: cfg.DatabasePath,
+		Dir:  cfg.BackupDir,
+		Keep: cfg.BackupKeep,
+	}
+
+	if b.Dir == "" {
+		b.Dir = "backups"
+	}
+
+	switch {
+	case b.Keep == 0:
+		b.Keep = 7
+	case b.Keep < -1:
+		return nil, fmt.Errorf("backup_keep: must be -1 to keep every backup or a positive number, got %d", b.Keep)
+	}
+
+	if cfg.BackupInterval != "" {
+		d, err := time.ParseDuration(cfg.BackupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("backup_interval: %v", err)
+		}
+
+		if d < time.Minute {
+			return nil, fmt.Errorf("backup_interval: %s is shorter than a minute", d)
+		}
+		b.Interval = d
+	}
+	return b, nil
+}
+
+// archiver returns the pin archiver for the archive repository. Channels with 45 pins have all but
+// their 35 newest pins archived automatically, in archive_format, unless configured otherwise.
+// A threshold of -1 disables it. With archive_mirror, files of up to 8 MB and 200 MB per archiving are mirrored.
+func (cfg *config) archiver(ses *discordgo.Session, token string) (*internal.Archiver, error) {
+	dir := cfg.ArchiveDir
+	if dir == "" {
+		dir = "archive"
+	}
+
+	a := &internal.Archiver{
+		Ses: ses,
+		Backend: &internal.GitBackend{
+			Remote: internal.GitRemote(cfg.ArchiveRepo),
+			Dir:    dir,
+			Token:  token,
+		},
+		Threshold: cfg.ArchiveThreshold,
+		Keep:      cfg.ArchiveKeep,
+	}
+
+	if cfg.ArchiveFormat != "" {
+		f, err := internal.ParseArchiveFormat(cfg.ArchiveFormat)
+		if err != nil {
+			return nil, fmt.Errorf("archive_format: %v", err)
+		}
+		a.Format = f
+	}
+
+	if cfg.ArchiveMirror {
+		a.Mirror = &internal.Mirror{
+			MaxSize:  int64(cfg.MirrorMaxSize) << 20,
+			MaxTotal: int64(cfg.MirrorMaxTotal) << 20,
+		}
+
+		if a.Mirror.MaxSize == 0 {
+			a.Mirror.MaxSize = 8 << 20
+		}
+
+		if a.Mirror.MaxTotal == 0 {
+			a.Mirror.MaxTotal = 200 << 20
+		}
+	}
+
+	if a.Threshold == 0 {
+		a.Threshold = 45
+	}
+
+	if a.Keep == 0 {
+		a.Keep = 35
+	}
+
+	if a.Threshold > 50 {
+		return nil, fmt.Errorf("archive_threshold: channels can't have more than 50 pins, got %d", a.Threshold)
+	}
+
+	if a.Threshold > 0 && (a.Keep < 0 || a.Keep >= a.Threshold) {
+		return nil, fmt.Errorf("archive_keep: must be between 0 and archive_threshold (%d), got %d", a.Threshold, a.Keep)
+	}
+	return a, nil
+}
+
+// loadConfig reads the config file at path and applies environment variable overrides
+func loadConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(config)
+	if err = json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err = cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides config fields with the environment variables set for them.
+// Fields that aren't strings or numbers are decoded from JSON.
+func (cfg *config) applyEnv() error {
+	v := reflect.ValueOf(cfg).Elem()
+	return eachEnvField(v, func(i int, key, val string) error {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(val)
+		case reflect.Int:
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("%s: expected a number, got %q", key, val)
+			}
+			f.SetInt(int64(n))
+		default:
+			if err := json.Unmarshal([]byte(val), f.Addr().Interface()); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// eachEnvField calls fn with the index, variable name and value of every field of the config v
+// that has an environment variable set
+func eachEnvField(v reflect.Value, fn func(i int, key, val string) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := envPrefix + strings.ToUpper(name)
+		if val, ok := os.LookupEnv(key); ok {
+			if err := fn(i, key, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// secrets are the API keys the bot needs. They're kept out of config.json so it can be shared.
+type secrets struct {
+	DiscordToken  string `json:"discord_token"`
+	ThronebuttKey string `json:"thronebutt_key"`
+	GithubKey     string `json:"github_key"`
+}
+
+// loadSecrets reads the secrets file at path, if any, then applies environment variables and finally
+// the command line flags. Flags are still supported but are visible to anyone who can run `ps`.
+func loadSecrets(path string) (*secrets, error) {
+	sec := new(secrets)
+	if path == "" {
+		path = os.Getenv(envPrefix + "SECRETS_FILE")
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(b, sec); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	for _, o := range []struct {
+		env  string
+		flag *string
+		dst  *string
+	}{
+		{"DISCORD_TOKEN", discordBotKey, &sec.DiscordToken},
+		{"THRONEBUTT_KEY", tbAPIKey, &sec.ThronebuttKey},
+		{"GITHUB_KEY", githubAPIKey, &sec.GithubKey},
+	} {
+		if val := os.Getenv(envPrefix + o.env); val != "" {
+			*o.dst = val
+		}
+
+		if *o.flag != "" {
+			log.Println("loadSecrets: secrets passed as flags are visible to other users, use", envPrefix+o.env, "or a secrets file instead")
+			*o.dst = *o.flag
+		}
+	}
+
+	return sec, nil
+}
+
+// watchConfig reloads the config at path whenever the process receives SIGHUP or,
+// if interval isn't zero, when the file's modification time changes.
+// Configs that fail to load are logged and ignored. Closing the returned channel stops watching.
+func watchConfig(path string, interval time.Duration, apply func(*config)) chan struct{} {
+	stop := make(chan struct{})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		tick = ticker.C
+		go func() {
+			<-stop
+			ticker.Stop()
+		}()
+	}
+
+	modTime := func() time.Time {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+
+		last := modTime()
+		for {
+			select {
+			case <-hup:
+				log.Println("watchConfig: received SIGHUP, reloading", path)
+			case <-tick:
+				mt := modTime()
+				if mt.IsZero() || mt.Equal(last) {
+					continue
+				}
+				log.Println("watchConfig:", path, "changed, reloading")
+			case <-stop:
+				return
+			}
+
+			last = modTime()
+			cfg, err := loadConfig(path)
+			if err != nil {
+				log.Println("watchConfig: failed to reload config, keeping the old one:", err)
+				continue
+			}
+			apply(cfg)
+		}
+	}()
+
+	return stop
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSuggestionLimit(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		json  string
+		set   *int
+		limit int
+	}{
+		{"unset", `{}`, nil, 3},
+		{"configured", `{"suggestion_limit": 5}`, nil, 5},
+		{"configured zero", `{"suggestion_limit": 0}`, nil, 0},
+		{"set zero", `{"suggestion_limit": 5}`, intPtr(0), 0},
+		{"set", `{}`, intPtr(2), 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(c.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the same round trip as `config set global`, then a reload
+			if c.set != nil {
+				gs := cfg.guildDefaults()
+				gs.SuggestionLimit = *c.set
+				cfg.setGuildDefaults(gs)
+				if err = cfg.save(path); err != nil {
+					t.Fatal(err)
+				}
+
+				if cfg, err = loadConfig(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := cfg.guildDefaults().SuggestionLimit; got != c.limit {
+				t.Errorf("suggestion limit is %d, want %d", got, c.limit)
+			}
+		})
+	}
+}
+
+func TestConfigBackupKeep(t *testing.T) {
+	for _, c := range []struct {
+		keep, want int
+		err        bool
+	}{
+		{0, 7, false},
+		{3, 3, false},
+		{-1, -1, false},
+		{-2, 0, true},
+	} {
+		b, err := (&config{BackupKeep: c.keep}).backups()
+		if c.err {
+			if err == nil {
+				t.Errorf("backup_keep %d: got %d, want an error", c.keep, b.Keep)
+			}
+			continue
+		}
+
+		if err != nil || b.Keep != c.want {
+			t.Errorf("backup_keep %d: got %v, %v, want %d", c.keep, b, err, c.want)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
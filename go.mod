@@ -1,11 +1,12 @@
 module github.com/Krognol/thronebot
 
-go 1.12
+go 1.16
 
 require (
 	github.com/Krognol/tbapi v0.0.0-20190707220836-30ff72469981
 	github.com/Necroforger/dgrouter v0.0.0-20190528143456-040421b5a83e // indirect
 	github.com/bwmarrin/discordgo v0.19.0
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/necroforger/dgrouter v0.0.0-20190528143456-040421b5a83e
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
@@ -1 +1,387 @@
 package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Krognol/thronebot/internal/router"
+	"github.com/bwmarrin/discordgo"
+)
+
+// ArchiveBackend stores archived pins. Paths are slash separated and relative to the archive's root.
+type ArchiveBackend interface {
+	// Sync fetches the latest version of the archive. ReadFile and Commit work on the version of the last Sync.
+	Sync() error
+	// ReadFile returns the file at p, or nil if it doesn't exist
+	ReadFile(p string) ([]byte, error)
+	// Commit writes the files, keyed by their path, and records them with message.
+	// It reports whether any file changed.
+	Commit(files map[string][]byte, message string) (bool, error)
+	// URL returns a link to the file at p which people can open, or "" if there is none
+	URL(p string) string
+}
+
+// Pin is an archived pinned message
+type Pin struct {
+	ID           string                    `json:"id"`
+	AuthorID     string                    `json:"author_id"`
+	Author       string                    `json:"author"`
+	AuthorAvatar string                    `json:"author_avatar,omitempty"`
+	Content      string                    `json:"content"`
+	Timestamp    time.Time                 `json:"timestamp"`
+	Edited       *time.Time                `json:"edited,omitempty"`
+	Attachments  []*PinAttachment          `json:"attachments,omitempty"`
+	Embeds       []*discordgo.MessageEmbed `json:"embeds,omitempty"`
+	// Mirrored maps the URLs of the pin's files to their copies in the archive
+	Mirrored map[string]string `json:"mirrored,omitempty"`
+}
+
+// PinAttachment is a file attached to an archived pin
+type PinAttachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	ProxyURL string `json:"proxy_url,omitempty"`
+	Size     int    `json:"size"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// NewPin converts a message to a pin
+func NewPin(m *discordgo.Message) *Pin {
+	p := &Pin{
+		ID:      m.ID,
+		Content: m.Content,
+		Embeds:  m.Embeds,
+	}
+
+	if m.Author != nil {
+		p.AuthorID = m.Author.ID
+		p.Author = m.Author.Username + "#" + m.Author.Discriminator
+		if m.Author.Avatar != "" {
+			p.AuthorAvatar = m.Author.AvatarURL("64")
+		}
+	}
+
+	if t, err := m.Timestamp.Parse(); err == nil {
+		p.Timestamp = t.UTC()
+	}
+
+	if t, err := m.EditedTimestamp.Parse(); err == nil {
+		t = t.UTC()
+		p.Edited = &t
+	}
+
+	for _, a := range m.Attachments {
+		p.Attachments = append(p.Attachments, &PinAttachment{
+			ID:       a.ID,
+			Filename: a.Filename,
+			URL:      a.URL,
+			ProxyURL: a.ProxyURL,
+			Size:     a.Size,
+			Width:    a.Width,
+			Height:   a.Height,
+		})
+	}
+	return p
+}
+
+// ChannelArchive is every pin archived from a channel, oldest first
+type ChannelArchive struct {
+	GuildID   string `json:"guild_id"`
+	Guild     string `json:"guild,omitempty"`
+	ChannelID string `json:"channel_id"`
+	Name      string `json:"name"`
+	Pins      []*Pin `json:"pins"`
+}
+
+// Path is where the archive is stored in the format. It's named by ID so renaming the channel keeps its archive.
+// The JSON file is the archive's data, which is read back to add more pins.
+func (c *ChannelArchive) Path(f ArchiveFormat) string {
+	return path.Join(c.GuildID, c.ChannelID+f.Ext())
+}
+
+// MessageURL returns the link to the pinned message on Discord
+func (c *ChannelArchive) MessageURL(p *Pin) string {
+	return "https://discordapp.com/channels/" + c.GuildID + "/" + c.ChannelID + "/" + p.ID
+}
+
+// merge adds pins to the archive. Pins which are already archived are replaced, so edits are kept,
+// but keep their mirrored files.
+func (c *ChannelArchive) merge(pins []*Pin) {
+	byID := make(map[string]int, len(c.Pins))
+	for i, p := range c.Pins {
+		byID[p.ID] = i
+	}
+
+	for _, p := range pins {
+		if i, ok := byID[p.ID]; ok {
+			if p.Mirrored == nil {
+				p.Mirrored = c.Pins[i].Mirrored
+			}
+			c.Pins[i] = p
+			continue
+		}
+		byID[p.ID] = len(c.Pins)
+		c.Pins = append(c.Pins, p)
+	}
+
+	sort.SliceStable(c.Pins, func(i, j int) bool { return c.Pins[i].Timestamp.Before(c.Pins[j].Timestamp) })
+}
+
+// Archiver archives the pinned messages of channels to a backend
+type Archiver struct {
+	Ses     *discordgo.Session
+	Backend ArchiveBackend
+
+	// Threshold is how many pins a channel can have before its oldest pins are archived and unpinned
+	// automatically. Zero disables automatic archiving. Discord allows at most 50 pins per channel.
+	Threshold int
+	// Keep is how many of the newest pins are left pinned when pins are archived automatically
+	Keep int
+	// Format is the format pins are archived in automatically, markdown if it's empty
+	Format ArchiveFormat
+	// Mirror copies the pins' files into the archive if it's set
+	Mirror *Mirror
+	// NoticeChannel returns the channel a guild's archiving notices are copied to, if any. Optional.
+	NoticeChannel func(guildID string) string
+
+	mu      sync.Mutex
+	pending sync.Map
+}
+
+// link returns a link to the archive of c in the format, or its path if the backend has no links
+func (a *Archiver) link(c *ChannelArchive, f ArchiveFormat) string {
+	if u := a.Backend.URL(c.Path(f)); u != "" {
+		return u
+	}
+	return "`" + c.Path(f) + "`"
+}
+
+// Archive archives every pinned message of the channel in the format. The channel's earlier archive is kept,
+// so messages which have been unpinned since stay archived. It reports whether anything changed.
+func (a *Archiver) Archive(channelID string, f ArchiveFormat, archivedBy string) (*ChannelArchive, bool, error) {
+	ch, err := a.Ses.Channel(channelID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	msgs, err := a.Ses.ChannelMessagesPinned(channelID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var pins []*Pin
+	for _, m := range msgs {
+		pins = append(pins, NewPin(m))
+	}
+
+	return a.archive(ch, pins, f, archivedBy)
+}
+
+// noticeChannel returns the channel archiving notices of the guild are copied to, or "" if it has none
+func (a *Archiver) noticeChannel(guildID string) string {
+	if a.NoticeChannel == nil {
+		return ""
+	}
+	return a.NoticeChannel(guildID)
+}
+
+// readJSON decodes the file at p of the backend into v. v is left alone if the file doesn't exist.
+func (a *Archiver) readJSON(p string, v interface{}) error {
+	b, err := a.Backend.ReadFile(p)
+	if err != nil || b == nil {
+		return err
+	}
+
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("archive: %s: %v", p, err)
+	}
+	return nil
+}
+
+func (a *Archiver) archive(ch *discordgo.Channel, pins []*Pin, f ArchiveFormat, archivedBy string) (*ChannelArchive, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.Backend.Sync(); err != nil {
+		return nil, false, err
+	}
+
+	c := &ChannelArchive{GuildID: ch.GuildID, ChannelID: ch.ID}
+	if err := a.readJSON(c.Path(FormatJSON), c); err != nil {
+		return nil, false, err
+	}
+
+	idx := new(ArchiveIndex)
+	if err := a.readJSON(indexPath(FormatJSON), idx); err != nil {
+		return nil, false, err
+	}
+
+	c.Name = ch.Name
+	if g, err := a.Ses.State.Guild(ch.GuildID); err == nil {
+		c.Guild = g.Name
+	}
+
+	c.merge(pins)
+	idx.update(c, f)
+
+	files := make(map[string][]byte)
+	if a.Mirror != nil {
+		a.Mirror.mirror(c.Pins, files)
+	}
+
+	for _, rf := range []ArchiveFormat{FormatJSON, f} {
+		b, err := rf.render(c)
+		if err != nil {
+			return nil, false, err
+		}
+		files[c.Path(rf)] = b
+	}
+
+	// Every index links every channel, so they're all updated
+	for _, rf := range ArchiveFormats {
+		if rf != FormatJSON && !idx.has(rf) {
+			continue
+		}
+
+		b, err := rf.renderIndex(idx)
+		if err != nil {
+			return nil, false, err
+		}
+		files[indexPath(rf)] = b
+	}
+
+	changed, err := a.Backend.Commit(files, fmt.Sprintf("Archive %d pins from #%s\n\nArchived by %s", len(pins), ch.Name, archivedBy))
+	if err != nil {
+		return nil, false, err
+	}
+	return c, changed, nil
+}
+
+// ArchiveHandler archives the pins of a channel, by default the one the command was sent in.
+// Archives are also announced in the guild's archive channel, if it has one.
+func ArchiveHandler(a *Archiver) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		channelID, f := ctx.Msg.ChannelID, FormatMarkdown
+		if ctx.Values.Has("channel") {
+			channelID = ctx.Values.String("channel")
+		}
+
+		if ctx.Values.Has("format") {
+			var err error
+			if f, err = ParseArchiveFormat(ctx.Values.String("format")); err != nil {
+				ctx.Reply(err)
+				return
+			}
+		}
+
+		ch, err := ctx.Channel(channelID)
+		if err != nil || ch.GuildID != ctx.GuildID() {
+			ctx.Reply("There's no channel `", channelID, "` in this server.")
+			return
+		}
+
+		ctx.Ses.ChannelTyping(ctx.Msg.ChannelID)
+
+		c, changed, err := a.Archive(ch.ID, f, ctx.Msg.Author.String())
+		if err != nil {
+			log.Println("archive:", err)
+			ctx.Reply("Failed to archive the pins of <#", ch.ID, ">.")
+			return
+		}
+
+		if !changed {
+			ctx.Reply("The pins of <#", ch.ID, "> are already archived.")
+			return
+		}
+		ctx.Reply("Archived ", len(c.Pins), " pins of <#", ch.ID, "> to ", a.link(c, f))
+
+		if notices := a.noticeChannel(ch.GuildID); notices != "" && notices != ctx.Msg.ChannelID {
+			if _, err = ctx.Ses.ChannelMessageSend(notices, fmt.Sprintf("%s archived %d pins of <#%s> to %s", ctx.Msg.Author.Mention(), len(c.Pins), ch.ID, a.link(c, f))); err != nil {
+				log.Println("archive: failed to post notice:", err)
+			}
+		}
+	}
+}
+
+// PinsUpdateHandler archives and unpins the oldest pins of a channel once it has Threshold pins.
+// A link to the archive is posted in the channel, and copied to the guild's archive channel if it has one.
+func (a *Archiver) PinsUpdateHandler() func(*discordgo.Session, *discordgo.ChannelPinsUpdate) {
+	return func(s *discordgo.Session, e *discordgo.ChannelPinsUpdate) {
+		if a.Threshold <= 0 {
+			return
+		}
+
+		// Unpinning fires more updates for the channel, those are ignored until it's done
+		if _, busy := a.pending.LoadOrStore(e.ChannelID, true); busy {
+			return
+		}
+
+		defer a.pending.Delete(e.ChannelID)
+
+		if err := a.archiveOldest(e.ChannelID); err != nil {
+			log.Println("archive: failed to archive old pins of", e.ChannelID, ":", err)
+		}
+	}
+}
+
+// archiveOldest archives and unpins every pin of the channel but the newest Keep, if it has Threshold pins
+func (a *Archiver) archiveOldest(channelID string) error {
+	ch, err := a.Ses.Channel(channelID)
+	if err != nil {
+		return err
+	}
+
+	if ch.GuildID == "" {
+		return nil
+	}
+
+	// Pins are listed by when they were pinned, newest first
+	msgs, err := a.Ses.ChannelMessagesPinned(channelID)
+	if err != nil {
+		return err
+	}
+
+	keep := a.Keep
+	if len(msgs) < a.Threshold || len(msgs) <= keep {
+		return nil
+	}
+
+	var pins []*Pin
+	for _, m := range msgs[keep:] {
+		pins = append(pins, NewPin(m))
+	}
+
+	f := a.Format
+	if f == "" {
+		f = FormatMarkdown
+	}
+
+	c, _, err := a.archive(ch, pins, f, "automatic archiving")
+	if err != nil {
+		return err
+	}
+
+	// Only unpin once the pins are safely archived
+	for _, m := range msgs[keep:] {
+		if err = a.Ses.ChannelMessageUnpin(channelID, m.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.Ses.ChannelMessageSend(channelID, fmt.Sprintf("This channel was close to the pin limit, so its %d oldest pins have been archived to %s", len(pins), a.link(c, f)))
+	if err != nil {
+		return err
+	}
+
+	if notices := a.noticeChannel(ch.GuildID); notices != "" && notices != channelID {
+		_, err = a.Ses.ChannelMessageSend(notices, fmt.Sprintf("<#%s> was close to the pin limit, so its %d oldest pins have been archived to %s", channelID, len(pins), a.link(c, f)))
+	}
+	return err
+}
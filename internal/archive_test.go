@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// memBackend keeps the archive in memory. onCommit is called at the start of every commit, if it's set.
+type memBackend struct {
+	files    map[string][]byte
+	commits  int
+	onCommit func()
+}
+
+func (b *memBackend) Sync() error { return nil }
+
+func (b *memBackend) ReadFile(p string) ([]byte, error) { return b.files[p], nil }
+
+func (b *memBackend) Commit(files map[string][]byte, message string) (bool, error) {
+	if b.onCommit != nil {
+		b.onCommit()
+	}
+
+	if b.files == nil {
+		b.files = make(map[string][]byte)
+	}
+
+	for p, f := range files {
+		b.files[p] = f
+	}
+	b.commits++
+	return true, nil
+}
+
+func (b *memBackend) URL(p string) string { return "https://archive.example/" + p }
+
+// fakeDiscord answers a session's requests for channels, their pins and messages
+type fakeDiscord struct {
+	mu       sync.Mutex
+	channels map[string]*discordgo.Channel
+	// pins are the pinned messages of each channel, newest first like Discord lists them
+	pins     map[string][]*discordgo.Message
+	requests int
+	unpinned []string
+	sent     []string
+}
+
+func (d *fakeDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.requests++
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/v6/channels/"), "/")
+
+	var res interface{}
+	switch {
+	case req.Method == "GET" && len(parts) == 1:
+		ch, ok := d.channels[parts[0]]
+		if !ok {
+			return d.respond(req, http.StatusNotFound, nil), nil
+		}
+		res = ch
+
+	case req.Method == "GET" && len(parts) == 2 && parts[1] == "pins":
+		res = d.pins[parts[0]]
+
+	case req.Method == "DELETE" && len(parts) == 3 && parts[1] == "pins":
+		var kept []*discordgo.Message
+		for _, m := range d.pins[parts[0]] {
+			if m.ID != parts[2] {
+				kept = append(kept, m)
+			}
+		}
+		d.pins[parts[0]] = kept
+		d.unpinned = append(d.unpinned, parts[2])
+
+	case req.Method == "POST" && len(parts) == 2 && parts[1] == "messages":
+		var m discordgo.MessageSend
+		if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+			return nil, err
+		}
+		d.sent = append(d.sent, parts[0]+": "+m.Content)
+		res = &discordgo.Message{ChannelID: parts[0], Content: m.Content}
+
+	default:
+		return d.respond(req, http.StatusNotFound, nil), nil
+	}
+	return d.respond(req, http.StatusOK, res), nil
+}
+
+func (d *fakeDiscord) respond(req *http.Request, status int, v interface{}) *http.Response {
+	b, _ := json.Marshal(v)
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(b))),
+		Request:    req,
+	}
+}
+
+func (d *fakeDiscord) pinCount(channelID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pins[channelID])
+}
+
+// pin pins n new messages in the channel
+func (d *fakeDiscord) pin(channelID string, n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	day := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("m%d", len(d.pins[channelID])+len(d.unpinned)+1)
+		m := &discordgo.Message{
+			ID:        id,
+			ChannelID: channelID,
+			Content:   "message " + id,
+			Timestamp: discordgo.Timestamp(day.Add(time.Duration(len(d.pins[channelID])+len(d.unpinned)) * time.Hour).Format(time.RFC3339)),
+			Author:    &discordgo.User{ID: "u1", Username: "fish", Discriminator: "0001"},
+		}
+		d.pins[channelID] = append([]*discordgo.Message{m}, d.pins[channelID]...)
+	}
+}
+
+func newFakeDiscord(t *testing.T) (*discordgo.Session, *fakeDiscord) {
+	ses, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDiscord{
+		channels: map[string]*discordgo.Channel{
+			"c1":      {ID: "c1", GuildID: "g1", Name: "general"},
+			"notices": {ID: "notices", GuildID: "g1", Name: "archive"},
+			"dm":      {ID: "dm"},
+		},
+		pins: make(map[string][]*discordgo.Message),
+	}
+	ses.Client = &http.Client{Transport: d}
+	return ses, d
+}
+
+func TestPinsUpdateHandler(t *testing.T) {
+	ses, d := newFakeDiscord(t)
+	backend := new(memBackend)
+	a := &Archiver{
+		Ses:           ses,
+		Backend:       backend,
+		Threshold:     5,
+		Keep:          2,
+		NoticeChannel: func(string) string { return "notices" },
+	}
+	handler := a.PinsUpdateHandler()
+
+	// Below the threshold nothing is archived
+	d.pin("c1", 4)
+	handler(ses, &discordgo.ChannelPinsUpdate{ChannelID: "c1"})
+	if backend.commits != 0 || len(d.unpinned) != 0 || len(d.sent) != 0 {
+		t.Fatalf("archived %d times, unpinned %v, sent %q below the threshold", backend.commits, d.unpinned, d.sent)
+	}
+
+	// Events for the channel which arrive while it's being archived are ignored
+	var nested int
+	backend.onCommit = func() {
+		before := d.requests
+		done := make(chan struct{})
+		go func() {
+			handler(ses, &discordgo.ChannelPinsUpdate{ChannelID: "c1"})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("an event during archiving is still running")
+			return
+		}
+		nested = d.requests - before
+	}
+
+	d.pin("c1", 2)
+	handler(ses, &discordgo.ChannelPinsUpdate{ChannelID: "c1"})
+
+	if nested != 0 {
+		t.Errorf("an event during archiving made %d requests, want none", nested)
+	}
+
+	if backend.commits != 1 {
+		t.Fatalf("archived %d times, want once", backend.commits)
+	}
+
+	// The oldest pins are archived and unpinned, the newest Keep stay pinned
+	want := []string{"m4", "m3", "m2", "m1"}
+	if !reflect.DeepEqual(d.unpinned, want) {
+		t.Errorf("unpinned %v, want %v", d.unpinned, want)
+	}
+
+	if n := d.pinCount("c1"); n != 2 {
+		t.Errorf("%d pins are left, want 2", n)
+	}
+
+	var c ChannelArchive
+	if err := json.Unmarshal(backend.files["g1/c1.json"], &c); err != nil {
+		t.Fatal(err)
+	}
+
+	var archived []string
+	for _, p := range c.Pins {
+		archived = append(archived, p.ID)
+	}
+
+	if want := []string{"m1", "m2", "m3", "m4"}; !reflect.DeepEqual(archived, want) {
+		t.Errorf("archived %v, want %v", archived, want)
+	}
+
+	link := "https://archive.example/g1/c1.md"
+	wantSent := []string{
+		"c1: This channel was close to the pin limit, so its 4 oldest pins have been archived to " + link,
+		"notices: <#c1> was close to the pin limit, so its 4 oldest pins have been archived to " + link,
+	}
+	if !reflect.DeepEqual(d.sent, wantSent) {
+		t.Errorf("sent %q, want %q", d.sent, wantSent)
+	}
+
+	// Once it's done the channel is archived again when it crosses the threshold
+	backend.onCommit = nil
+	d.pin("c1", 3)
+	handler(ses, &discordgo.ChannelPinsUpdate{ChannelID: "c1"})
+	if backend.commits != 2 || d.pinCount("c1") != 2 {
+		t.Errorf("archived %d times with %d pins left, want twice with 2", backend.commits, d.pinCount("c1"))
+	}
+}
+
+func TestPinsUpdateHandlerIgnored(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		channelID string
+		threshold int
+	}{
+		{"disabled", "c1", 0},
+		{"direct messages", "dm", 5},
+	} {
+		ses, d := newFakeDiscord(t)
+		backend := new(memBackend)
+		a := &Archiver{Ses: ses, Backend: backend, Threshold: c.threshold, Keep: 2}
+
+		d.pin(c.channelID, 10)
+		a.PinsUpdateHandler()(ses, &discordgo.ChannelPinsUpdate{ChannelID: c.channelID})
+		if backend.commits != 0 || len(d.unpinned) != 0 || len(d.sent) != 0 {
+			t.Errorf("%s: archived %d times, unpinned %v, sent %q", c.name, backend.commits, d.unpinned, d.sent)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPrefix and backupExt surround the timestamp in backup file names, so they sort by age
+const (
+	backupPrefix = "thronebot-"
+	backupExt    = ".db"
+	backupTime   = "20060102-150405"
+)
+
+// Backups copies the SQLite database into a directory with the online backup API, which is safe
+// while the bot is using the database. Only the newest Keep backups are kept.
+type Backups struct {
+	// Path is the database file
+	Path string
+	// Dir is the directory backups are written to
+	Dir string
+	// Keep is how many backups are kept. Zero or less keeps every backup.
+	Keep int
+	// Interval is how often a backup is made in the background. Zero disables scheduled backups.
+	Interval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// Start starts making scheduled backups in the background
+func (b *Backups) Start() {
+	if b.Interval <= 0 {
+		return
+	}
+
+	b.stop = make(chan struct{})
+	go b.loop()
+}
+
+// Stop stops making scheduled backups
+func (b *Backups) Stop() {
+	if b.stop != nil {
+		close(b.stop)
+	}
+}
+
+func (b *Backups) loop() {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := b.Snapshot(); err != nil {
+				log.Println("backups: scheduled backup failed:", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Snapshot backs up the database and removes old backups. It returns the path of the new backup.
+func (b *Backups) Snapshot() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(b.Dir, backupPrefix+time.Now().UTC().Format(backupTime)+backupExt)
+	if err := backupSQLite(b.Path, name); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+
+	log.Println("backups: saved", name)
+	return name, b.rotate()
+}
+
+// List returns the paths of every backup, oldest first
+func (b *Backups) List() ([]string, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var res []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), backupExt) {
+			res = append(res, filepath.Join(b.Dir, e.Name()))
+		}
+	}
+
+	sort.Strings(res)
+	return res, nil
+}
+
+// rotate removes every backup but the newest Keep
+func (b *Backups) rotate() error {
+	if b.Keep <= 0 {
+		return nil
+	}
+
+	backups, err := b.List()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > b.Keep {
+		if err = os.Remove(backups[0]); err != nil {
+			return err
+		}
+		log.Println("backups: removed", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backupSQLite copies the database at src to a new database at dst
+func backupSQLite(src, dst string) error {
+	drv := &sqlite3.SQLiteDriver{}
+
+	srcConn, err := drv.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer srcConn.Close()
+
+	dstConn, err := drv.Open(dst)
+	if err != nil {
+		return err
+	}
+
+	defer dstConn.Close()
+
+	bk, err := dstConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+
+	// Copying everything in one step holds a read lock on the source until it's done, which is
+	// fine for a database this small
+	if _, err = bk.Step(-1); err != nil {
+		bk.Close()
+		return err
+	}
+
+	return bk.Finish()
+}
+
+// Restore replaces the SQLite database at path with the backup at src. The backup must pass an
+// integrity check and can't have a newer schema version than this build supports.
+// The replaced database is kept next to it. The bot must not be running.
+func Restore(src, path string) error {
+	// SQLite creates missing databases, so a mistyped path would restore an empty one
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("restore: %v", err)
+	}
+
+	db, err := OpenDB(SQLite.Name, "file:"+(&url.URL{Path: src}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return err
+	}
+
+	version, err := checkBackup(db)
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("restore: %s isn't a usable backup: %v", src, err)
+	}
+
+	// Copy the backup next to the database first, so the swap itself is a rename
+	tmp := path + ".restore"
+	if err = copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		old := path + ".before-restore-" + time.Now().UTC().Format(backupTime)
+		if err = os.Rename(path, old); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		log.Println("restore: moved the current database to", old)
+	}
+
+	// A journal left behind by the old database would be applied to the restored one
+	os.Remove(path + "-journal")
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	log.Println("restore: restored", src, "at schema version", version)
+	return nil
+}
+
+// checkBackup checks the integrity and schema version of a backup and returns the version
+func checkBackup(db *DB) (int, error) {
+	var res string
+	if err := db.QueryRow("PRAGMA integrity_check;").Scan(&res); err != nil {
+		return 0, err
+	}
+
+	if res != "ok" {
+		return 0, errors.New("integrity check failed: " + res)
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 {
+		return 0, errors.New("it has no schema version")
+	}
+
+	if latest := SQLite.migrations[len(SQLite.migrations)-1].version; version > latest {
+		return 0, fmt.Errorf("its schema version %d is newer than this build's %d", version, latest)
+	}
+	return version, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
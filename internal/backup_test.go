@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeBackups creates empty files with the names in dir
+func writeBackups(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dirNames returns the names of the files in dir
+func dirNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res []string
+	for _, e := range entries {
+		res = append(res, e.Name())
+	}
+	return res
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	b := &Backups{Path: filepath.Join(dir, "thronebot.db"), Dir: filepath.Join(dir, "backups"), Keep: 2}
+
+	db, err := OpenDB(SQLite.Name, b.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := NewSQLStore(db).InsertSuggestion("u1", &Build{Char: "fish", Weap: "gl", Crown: "death"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Mkdir(b.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeBackups(t, b.Dir, "thronebot-20200101-000000.db", "thronebot-20200102-000000.db", "notes.txt")
+
+	// The database is in use while it's backed up
+	name, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(name) != b.Dir || !strings.HasPrefix(filepath.Base(name), backupPrefix) {
+		t.Errorf("got backup %s, want it in %s", name, b.Dir)
+	}
+
+	want := []string{"notes.txt", "thronebot-20200102-000000.db", filepath.Base(name)}
+	if got := dirNames(t, b.Dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got backups %q, want %q", got, want)
+	}
+
+	backup, err := OpenDB(SQLite.Name, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	if sg, err := NewSQLStore(backup).Suggestion(id); err != nil || sg == nil || sg.UserID != "u1" {
+		t.Errorf("got suggestion %+v, %v from the backup, want u1's", sg, err)
+	}
+
+	if _, err = checkBackup(backup); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	backups := []string{
+		"thronebot-20200101-000000.db",
+		"thronebot-20200101-120000.db",
+		"thronebot-20200102-000000.db",
+		"thronebot-20210101-000000.db",
+	}
+
+	for _, c := range []struct {
+		keep int
+		want []string
+	}{
+		{1, backups[3:]},
+		{3, backups[1:]},
+		{4, backups},
+		{10, backups},
+		{0, backups},
+		{-1, backups},
+	} {
+		dir := t.TempDir()
+		writeBackups(t, dir, backups...)
+		writeBackups(t, dir, "thronebot.db", "thronebot-notes.txt")
+
+		b := &Backups{Dir: dir, Keep: c.keep}
+		if err := b.rotate(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := b.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, p := range got {
+			names = append(names, filepath.Base(p))
+		}
+
+		if !reflect.DeepEqual(names, c.want) {
+			t.Errorf("keeping %d: got %q, want %q", c.keep, names, c.want)
+		}
+
+		// Other files are left alone
+		if n := len(dirNames(t, dir)); n != len(c.want)+2 {
+			t.Errorf("keeping %d: %d files are left, want %d", c.keep, n, len(c.want)+2)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	backup, path := filepath.Join(dir, "backup #1.db"), filepath.Join(dir, "thronebot.db")
+
+	db, err := OpenDB(SQLite.Name, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := Migrate(db)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A mistyped backup path fails without creating a database there
+	missing := filepath.Join(dir, "typo.db")
+	if err = Restore(missing, path); err == nil {
+		t.Error("restoring a missing backup succeeded")
+	}
+	if _, err = os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("restoring a missing backup created it: %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("restoring a missing backup created the database: %v", err)
+	}
+
+	if err = Restore(backup, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = OpenDB(SQLite.Name, path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if v, err := SchemaVersion(db); err != nil || v != version {
+		t.Errorf("restored database is at schema version %d, %v, want %d", v, err, version)
+	}
+}
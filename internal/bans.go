@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Krognol/thronebot/internal/router"
+	"github.com/bwmarrin/discordgo"
+)
+
+// BanKind is the kind of item a ban applies to
+type BanKind string
+
+// Kinds of bannable items
+const (
+	BanChar     BanKind = "char"
+	BanCrown    BanKind = "crown"
+	BanWeapon   BanKind = "wep"
+	BanMutation BanKind = "mut"
+	BanUltra    BanKind = "ultra"
+)
+
+// BanKinds lists every kind of bannable item in display order
+var BanKinds = []BanKind{BanChar, BanCrown, BanWeapon, BanMutation, BanUltra}
+
+// Items returns the item map the kind's IDs belong to, or nil for an unknown kind
+func (k BanKind) Items() *itemMap {
+	switch k {
+	case BanChar:
+		return Chars
+	case BanCrown:
+		return Crowns
+	case BanWeapon:
+		return Weapons
+	case BanMutation:
+		return Mutations
+	case BanUltra:
+		return Ultras
+	}
+	return nil
+}
+
+// Resolver returns the resolver for names of the kind's items, or nil for an unknown kind
+func (k BanKind) Resolver() *ItemResolver {
+	switch k {
+	case BanChar:
+		return CharResolver
+	case BanCrown:
+		return CrownResolver
+	case BanWeapon:
+		return WeaponResolver
+	case BanMutation:
+		return MutationResolver
+	case BanUltra:
+		return UltraResolver
+	}
+	return nil
+}
+
+// Complete suggests items of the kind for a partially typed name. It's the autocompletion of slash command options.
+func (k BanKind) Complete(value string, _ map[string]string) []string {
+	if r := k.Resolver(); r != nil {
+		return r.Complete(value)
+	}
+	return nil
+}
+
+// Parse resolves the name of an item of the kind. It parses arguments of the kind's items.
+func (k BanKind) Parse(value string, _ router.Values) (interface{}, error) {
+	r := k.Resolver()
+	if r == nil {
+		return nil, errors.New("Invalid option: " + string(k))
+	}
+	return r.Resolve(value)
+}
+
+// ParseBanItem resolves the name of an item of the kind given in the `kind` argument
+func ParseBanItem(value string, values router.Values) (interface{}, error) {
+	return BanKind(values.String("kind")).Parse(value, values)
+}
+
+// CompleteBanItem suggests items of the kind chosen in the `kind` option for a partially typed name
+func CompleteBanItem(value string, opts map[string]string) []string {
+	return BanKind(opts["kind"]).Complete(value, opts)
+}
+
+// Title returns the plural display name of the kind
+func (k BanKind) Title() string {
+	switch k {
+	case BanChar:
+		return "Characters"
+	case BanCrown:
+		return "Crowns"
+	case BanWeapon:
+		return "Weapons"
+	case BanMutation:
+		return "Mutations"
+	case BanUltra:
+		return "Ultra mutations"
+	}
+	return string(k)
+}
+
+// Ban is a single banned weekly item
+type Ban struct {
+	Kind     BanKind
+	ItemID   int
+	Reason   string
+	BannedBy string
+	Created  time.Time
+	// Expires is zero for permanent bans
+	Expires time.Time
+}
+
+// Name returns the item's display name
+func (b *Ban) Name() string {
+	if items := b.Kind.Items(); items != nil {
+		if name := items.IDToName(b.ItemID); name != "" {
+			return name
+		}
+	}
+	return strconv.Itoa(b.ItemID)
+}
+
+// activeAt reports whether the ban hasn't expired at now
+func (b *Ban) activeAt(now time.Time) bool {
+	return b.Expires.IsZero() || b.Expires.After(now)
+}
+
+// banKey identifies a bannable item
+type banKey struct {
+	Kind   BanKind
+	ItemID int
+}
+
+// banKeys returns every bannable item of a build
+func banKeys(b *Build) []banKey {
+	keys := []banKey{
+		{BanChar, Chars.NameToID(b.Char)},
+		{BanWeapon, Weapons.NameToID(b.Weap)},
+		{BanCrown, Crowns.NameToID(b.Crown)},
+	}
+
+	for _, mut := range b.Mutations {
+		keys = append(keys, banKey{BanMutation, Mutations.NameToID(mut)})
+	}
+
+	if b.Ultra != "" {
+		keys = append(keys, banKey{BanUltra, Ultras.NameToID(b.Ultra)})
+	}
+	return keys
+}
+
+// GetBannedHandler returns a router handler which prints the banned weekly items
+func GetBannedHandler(store WeeklyStore) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		bans, err := store.Bans(time.Now())
+		if err != nil {
+			log.Println("getBanned:", err)
+			ctx.Reply("Failed to retrieve banned items.")
+			return
+		}
+
+		if len(bans) == 0 {
+			ctx.Reply("Nothing is currently banned.")
+			return
+		}
+
+		byKind := make(map[BanKind][]string)
+		for _, b := range bans {
+			line := b.Name()
+			if b.Reason != "" {
+				line += " - " + b.Reason
+			}
+
+			if !b.Expires.IsZero() {
+				line += " (until " + b.Expires.UTC().Format("2006-01-02 15:04") + " UTC)"
+			}
+			byKind[b.Kind] = append(byKind[b.Kind], line)
+		}
+
+		var buf strings.Builder
+
+		buf.WriteString("Currently banned items:\n\n")
+
+		for _, kind := range BanKinds {
+			if lines := byKind[kind]; len(lines) > 0 {
+				buf.WriteString("**" + kind.Title() + ":**\n  ")
+				buf.WriteString(strings.Join(lines, "\n  "))
+				buf.WriteString("\n")
+			}
+		}
+
+		ctx.Reply(buf.String())
+	}
+}
+
+// BanSweeper periodically removes expired bans and announces them
+type BanSweeper struct {
+	Store WeeklyStore
+	Ses   *discordgo.Session
+
+	// Channels returns the staff channels unbans are announced in
+	Channels func() []string
+
+	stop chan struct{}
+}
+
+// Start starts the sweeper in the background
+func (bs *BanSweeper) Start() {
+	bs.stop = make(chan struct{})
+	go bs.loop()
+}
+
+// Stop stops the sweeper
+func (bs *BanSweeper) Stop() {
+	if bs.stop != nil {
+		close(bs.stop)
+	}
+}
+
+func (bs *BanSweeper) loop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		bs.sweep(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-bs.stop:
+			return
+		}
+	}
+}
+
+func (bs *BanSweeper) sweep(now time.Time) {
+	expired, err := bs.Store.PruneExpiredBans(now)
+	if err != nil {
+		log.Println("banSweeper:", err)
+		return
+	}
+
+	if len(expired) == 0 {
+		return
+	}
+
+	var buf strings.Builder
+	buf.WriteString("The following weekly bans have expired:\n")
+	for _, b := range expired {
+		buf.WriteString("  " + string(b.Kind) + " " + b.Name())
+		if b.BannedBy != "" {
+			buf.WriteString(" (banned by <@" + b.BannedBy + ">)")
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, channel := range bs.Channels() {
+		if _, err = bs.Ses.ChannelMessageSend(channel, buf.String()); err != nil {
+			log.Println("banSweeper: failed to announce unbans:", err)
+		}
+	}
+}
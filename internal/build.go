@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Build is a weekly character/skin/weapon/crown selection with optional
+// starting mutations and ultra mutation
+type Build struct {
+	Char      string
+	Skin      bool
+	Weap      string
+	Crown     string
+	Mutations []string
+	Ultra     string
+}
+
+// ParseBuild parses and validates a build in the `char/skin/weapon/crown[/mutations[/ultra]]` format,
+// where mutations is a comma separated list or `none`.
+// Item names are resolved to their canonical names, so aliases like `yv/b/gl/crown of death` are accepted.
+func ParseBuild(s string) (*Build, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 4 {
+		return nil, errors.New("Too few arguments")
+	}
+
+	var (
+		b   = &Build{Skin: strings.EqualFold(strings.TrimSpace(parts[1]), "b")}
+		err error
+	)
+
+	if b.Char, err = CharResolver.Resolve(parts[0]); err != nil {
+		return nil, err
+	}
+
+	if b.Weap, err = WeaponResolver.Resolve(parts[2]); err != nil {
+		return nil, err
+	}
+
+	if b.Crown, err = CrownResolver.Resolve(parts[3]); err != nil {
+		return nil, err
+	}
+
+	if len(parts) > 4 {
+		if b.Mutations, err = parseMutations(parts[4]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(parts) > 5 && strings.TrimSpace(parts[5]) != "" {
+		if b.Ultra, err = UltraResolver.Resolve(parts[5]); err != nil {
+			return nil, err
+		}
+
+		if u, _ := Ultras.Get(b.Ultra); u.Char != b.Char {
+			return nil, fmt.Errorf("`%s` is not an ultra mutation of %s", u.Display, Chars.Display(b.Char))
+		}
+	}
+
+	return b, nil
+}
+
+func parseMutations(s string) ([]string, error) {
+	var res []string
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(s, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		mut, err := MutationResolver.Resolve(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if mut == "none" || seen[mut] {
+			continue
+		}
+
+		seen[mut] = true
+		res = append(res, mut)
+	}
+
+	return res, nil
+}
+
+// JoinedMutations returns the mutations in the comma separated form used by the build format
+func (b *Build) JoinedMutations() string {
+	return strings.Join(b.Mutations, ",")
+}
+
+// SplitMutations parses mutations stored by JoinedMutations
+func SplitMutations(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// SkinName returns the skin as the letter used in the build format
+func (b *Build) SkinName() string {
+	if b.Skin {
+		return "B"
+	}
+	return "A"
+}
+
+func (b *Build) String() string {
+	s := b.Char + "/" + strings.ToLower(b.SkinName()) + "/" + b.Weap + "/" + b.Crown
+	if len(b.Mutations) == 0 && b.Ultra == "" {
+		return s
+	}
+
+	muts := b.JoinedMutations()
+	if muts == "" {
+		muts = "none"
+	}
+
+	s += "/" + muts
+	if b.Ultra != "" {
+		s += "/" + b.Ultra
+	}
+	return s
+}
@@ -2,29 +2,168 @@ package internal
 
 import (
 	"log"
+	"sync"
 
 	"github.com/Krognol/thronebot/internal/router"
 	"github.com/bwmarrin/discordgo"
 )
 
-// ElevatedUser checks for elevated admin permissions or bot owner ID
-func ElevatedUser(fn router.HandlerFunc) router.HandlerFunc {
-	return func(ctx *router.Context) {
-		if ctx.Msg.Author.ID == "95957677376540672" {
-			fn(ctx)
-			return
+// Level is a permission level. Higher levels include every lower level.
+type Level int
+
+// Permission levels, lowest first
+const (
+	LevelUser Level = iota
+	LevelTrusted
+	LevelStaff
+	LevelAdmin
+	LevelOwner
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelUser:
+		return "user"
+	case LevelTrusted:
+		return "trusted"
+	case LevelStaff:
+		return "staff"
+	case LevelAdmin:
+		return "admin"
+	case LevelOwner:
+		return "owner"
+	}
+	return "unknown"
+}
+
+// LevelMembers are the Discord roles and users granted a level
+type LevelMembers struct {
+	Roles []string `json:"roles"`
+	Users []string `json:"users"`
+}
+
+func (m *LevelMembers) has(userID string, roles []string) bool {
+	for _, id := range m.Users {
+		if id == userID {
+			return true
+		}
+	}
+
+	for _, id := range m.Roles {
+		for _, r := range roles {
+			if id == r {
+				return true
+			}
 		}
+	}
+	return false
+}
+
+// Permissions configures who has which permission level.
+// Guild owners and members with the Administrator permission are always admins.
+type Permissions struct {
+	Owners  []string     `json:"owners"`
+	Admin   LevelMembers `json:"admin"`
+	Staff   LevelMembers `json:"staff"`
+	Trusted LevelMembers `json:"trusted"`
+
+	// GuildStaffRole returns the staff role configured for a guild, if any
+	GuildStaffRole func(guildID string) string `json:"-"`
+}
+
+var (
+	permsMu sync.RWMutex
+	perms   = new(Permissions)
+)
+
+// SetPermissions replaces the permission configuration used by LevelOf
+func SetPermissions(p *Permissions) {
+	permsMu.Lock()
+	perms = p
+	permsMu.Unlock()
+}
+
+// levelKey is the context variable LevelOf stores its result in
+const levelKey = "thronebot.level"
 
-		perms, err := ctx.Ses.UserChannelPermissions(ctx.Msg.Author.ID, ctx.Msg.ChannelID)
-		if err != nil {
-			log.Println("commands: failed to retrieve channel permissions:", err)
-			ctx.Reply("Could not retrieve channel permissions: ", err)
-			return
+// LevelOf returns the permission level of the author of ctx.
+// The level is looked up once per context, so checking several permissions doesn't repeat the REST calls.
+func LevelOf(ctx *router.Context) Level {
+	if l, ok := ctx.Get(levelKey); ok {
+		return l.(Level)
+	}
+
+	l := levelOf(ctx)
+	ctx.Set(levelKey, l)
+	return l
+}
+
+func levelOf(ctx *router.Context) Level {
+	permsMu.RLock()
+	p := perms
+	permsMu.RUnlock()
+
+	uid := ctx.Msg.Author.ID
+	for _, id := range p.Owners {
+		if id == uid {
+			return LevelOwner
 		}
+	}
 
-		if (perms&discordgo.PermissionAll != 0) || (perms&discordgo.PermissionAllChannel != 0) {
-			fn(ctx)
-			return
+	guildID := ctx.GuildID()
+	if guildID == "" {
+		return LevelUser
+	}
+
+	if g, err := ctx.Guild(guildID); err == nil && g.OwnerID == uid {
+		return LevelAdmin
+	}
+
+	if chperms, err := ctx.Ses.UserChannelPermissions(uid, ctx.Msg.ChannelID); err != nil {
+		log.Println("commands: failed to retrieve channel permissions:", err)
+	} else if chperms&discordgo.PermissionAdministrator != 0 {
+		return LevelAdmin
+	}
+
+	var roles []string
+	if m, err := ctx.Member(guildID, uid); err != nil {
+		log.Println("commands: failed to retrieve member:", err)
+	} else {
+		roles = m.Roles
+	}
+
+	var guildStaff LevelMembers
+	if p.GuildStaffRole != nil {
+		if role := p.GuildStaffRole(guildID); role != "" {
+			guildStaff.Roles = []string{role}
 		}
 	}
+
+	switch {
+	case p.Admin.has(uid, roles):
+		return LevelAdmin
+	case p.Staff.has(uid, roles), guildStaff.has(uid, roles):
+		return LevelStaff
+	case p.Trusted.has(uid, roles):
+		return LevelTrusted
+	}
+	return LevelUser
+}
+
+// Permission returns a router permission which requires level l or higher
+func (l Level) Permission() *router.Permission {
+	return &router.Permission{
+		Name: l.String(),
+		Check: func(ctx *router.Context) bool {
+			return LevelOf(ctx) >= l
+		},
+		Deny: func(ctx *router.Context) {
+			ctx.Reply(ctx.Msg.Author.Mention(), " you need to be ", l, " or higher to use this command.")
+		},
+	}
+}
+
+// RequireLevel returns a middleware which only runs the handler for users with level l or higher
+func RequireLevel(l Level) router.MiddlewareFunc {
+	return l.Permission().Middleware()
 }
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the differences between the SQL of the supported database engines.
+// Queries are written with `?` placeholders and rewritten for engines that number them.
+type Dialect struct {
+	Name string
+
+	// numbered is set for engines which use $1, $2, ... instead of ? placeholders
+	numbered bool
+	// returning is set for engines which support RETURNING on INSERT and DELETE
+	returning bool
+	// migrations bring a database of this engine up to date
+	migrations []migration
+	// lockMigrations keeps other instances from migrating the database until tx ends
+	lockMigrations func(tx *Tx) error
+}
+
+// Supported database engines
+var (
+	SQLite = &Dialect{
+		Name:           "sqlite3",
+		migrations:     sqliteMigrations,
+		lockMigrations: func(*Tx) error { return nil },
+	}
+
+	Postgres = &Dialect{
+		Name:       "postgres",
+		numbered:   true,
+		returning:  true,
+		migrations: postgresMigrations,
+		lockMigrations: func(tx *Tx) error {
+			// An arbitrary key shared by every instance of the bot
+			_, err := tx.Exec("SELECT pg_advisory_xact_lock(7466212);")
+			return err
+		},
+	}
+)
+
+// DialectOf returns the dialect of a database/sql driver name
+func DialectOf(driver string) (*Dialect, error) {
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q, expected sqlite3 or postgres", driver)
+}
+
+// rebind rewrites the ? placeholders of q for the dialect. Question marks in string literals are left alone.
+func (d *Dialect) rebind(q string) string {
+	if !d.numbered || !strings.Contains(q, "?") {
+		return q
+	}
+
+	var (
+		buf     strings.Builder
+		n       int
+		inQuote bool
+	)
+
+	for _, r := range q {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			buf.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// DB is a database handle which rewrites queries for its dialect
+type DB struct {
+	*sql.DB
+	Dialect *Dialect
+}
+
+// OpenDB opens a database with the given driver, `sqlite3` or `postgres`.
+// The data source is a file path for SQLite and a connection string for PostgreSQL.
+func OpenDB(driver, source string) (*DB, error) {
+	d, err := DialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(d.Name, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{DB: db, Dialect: d}, nil
+}
+
+// Exec executes a query without returning any rows
+func (db *DB) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.rebind(q), args...)
+}
+
+// Query executes a query that returns rows
+func (db *DB) Query(q string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.rebind(q), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (db *DB) QueryRow(q string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.rebind(q), args...)
+}
+
+// Begin starts a transaction
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+// Tx is a transaction which rewrites queries for its dialect
+type Tx struct {
+	*sql.Tx
+	Dialect *Dialect
+}
+
+// Exec executes a query without returning any rows
+func (tx *Tx) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Dialect.rebind(q), args...)
+}
+
+// Query executes a query that returns rows
+func (tx *Tx) Query(q string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.Dialect.rebind(q), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row
+func (tx *Tx) QueryRow(q string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.Dialect.rebind(q), args...)
+}
+
+// Prepare creates a prepared statement for use within the transaction
+func (tx *Tx) Prepare(q string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.Dialect.rebind(q))
+}
+
+// insertID runs the INSERT statement q, which must not end in a semicolon, and returns the value of
+// the id column of the new row
+func (tx *Tx) insertID(q, id string, args ...interface{}) (int64, error) {
+	if tx.Dialect.returning {
+		var res int64
+		err := tx.QueryRow(q+" RETURNING "+id+";", args...).Scan(&res)
+		return res, err
+	}
+
+	res, err := tx.Exec(q+";", args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// boolInt converts b to the 0 or 1 stored in INTEGER columns
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
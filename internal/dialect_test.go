@@ -0,0 +1,42 @@
+package internal
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		dialect *Dialect
+		q, want string
+	}{
+		{SQLite, "SELECT * FROM t WHERE a = ? AND b = ?;", "SELECT * FROM t WHERE a = ? AND b = ?;"},
+		{Postgres, "SELECT * FROM t;", "SELECT * FROM t;"},
+		{Postgres, "SELECT * FROM t WHERE a = ? AND b = ?;", "SELECT * FROM t WHERE a = $1 AND b = $2;"},
+		{Postgres, "INSERT INTO t(a, b, c) VALUES (?, ?, ?)", "INSERT INTO t(a, b, c) VALUES ($1, $2, $3)"},
+		{Postgres, "SELECT 'why?' FROM t WHERE a = ?;", "SELECT 'why?' FROM t WHERE a = $1;"},
+		{Postgres, "SELECT * FROM t WHERE a = 'it''s?' AND b = ?;", "SELECT * FROM t WHERE a = 'it''s?' AND b = $1;"},
+		{Postgres, "SELECT * FROM t WHERE a IN (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);", "SELECT * FROM t WHERE a IN ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);"},
+	}
+
+	for _, c := range cases {
+		if got := c.dialect.rebind(c.q); got != c.want {
+			t.Errorf("%s: rebind(%q) = %q, want %q", c.dialect.Name, c.q, got, c.want)
+		}
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	for driver, want := range map[string]*Dialect{
+		"":           SQLite,
+		"sqlite":     SQLite,
+		"sqlite3":    SQLite,
+		"postgres":   Postgres,
+		"postgresql": Postgres,
+	} {
+		if d, err := DialectOf(driver); err != nil || d != want {
+			t.Errorf("DialectOf(%q) = %v, %v, want %s", driver, d, err, want.Name)
+		}
+	}
+
+	if _, err := DialectOf("mysql"); err == nil {
+		t.Error("DialectOf(mysql) succeeded")
+	}
+}
@@ -1,225 +1,239 @@
 package internal
 
-type itemMap map[string]int
-
-// Weapons is a map of in-game weapons with their corresponding IDs
-var Weapons = itemMap{
-	"none":                    0,
-	"revolver":                1,
-	"triple machinegun":       2,
-	"wrench":                  3,
-	"machinegun":              4,
-	"shotgun":                 5,
-	"crossbow":                6,
-	"grenade launcher":        7,
-	"double shotgun":          8,
-	"minigun":                 9,
-	"auto shotgun":            10,
-	"auto crossbow":           11,
-	"super crossbow":          12,
-	"shovel":                  13,
-	"bazooka":                 14,
-	"sticky launcher":         15,
-	"smg":                     16,
-	"assault rifle":           17,
-	"disc gun":                18,
-	"laser pistol":            19,
-	"laser rifle":             20,
-	"slugger":                 21,
-	"gatling slugger":         22,
-	"assault slugger":         23,
-	"energy sword":            24,
-	"super slugger":           25,
-	"hyper rifle":             26,
-	"screwdriver":             27,
-	"laser minigun":           28,
-	"blood launcher":          29,
-	"splinter gun":            30,
-	"toxic bow":               31,
-	"sentry gun":              32,
-	"wave gun":                33,
-	"plasma gun":              34,
-	"plasma cannon":           35,
-	"energy hammer":           36,
-	"jackhammer":              37,
-	"flak cannon":             38,
-	"golden revolver":         39,
-	"golden wrench":           40,
-	"golden machinegun":       41,
-	"golden shotgun":          42,
-	"golden crossbow":         43,
-	"golden grenade launcher": 44,
-	"golden laser pistol":     45,
-	"chicken sword":           46,
-	"nuke launcher":           47,
-	"ion cannon":              48,
-	"quadruple machinegun":    49,
-	"flamethrower":            50,
-	"dragon":                  51,
-	"flare gun":               52,
-	"energy screwdriver":      53,
-	"hyper launcher":          54,
-	"laser cannon":            55,
-	"rusty revolver":          56,
-	"lightning pistol":        57,
-	"lightning rifle":         58,
-	"lightning shotgun":       59,
-	"super flak cannon":       60,
-	"sawed off shotgun":       61,
-	"splinter pistol":         62,
-	"super splinter gun":      63,
-	"lightning smg":           64,
-	"smart gun":               65,
-	"heavy crossbow":          66,
-	"blood hammer":            67,
-	"lightning cannon":        68,
-	"pop gun":                 69,
-	"plasma rifle":            70,
-	"pop rifle":               71,
-	"toxic launcher":          72,
-	"flame cannon":            73,
-	"lightning hammer":        74,
-	"flame shotgun":           75,
-	"double flame shotgun":    76,
-	"auto flame shotgun":      77,
-	"cluster launcher":        78,
-	"grenade shotgun":         79,
-	"grenade rifle":           80,
-	"rogue rifle":             81,
-	"party gun":               82,
-	"double minigun":          83,
-	"gatling bazooka":         84,
-	"auto grenade shotgun":    85,
-	"ultra revolver":          86,
-	"ultra laser pistol":      87,
-	"sledgehammer":            88,
-	"heavy revolver":          89,
-	"heavy machinegun":        90,
-	"heavy slugger":           91,
-	"ultra shovel":            92,
-	"ultra shotgun":           93,
-	"ultra crossbow":          94,
-	"ultra grenade launcher":  95,
-	"plasma minigun":          96,
-	"devastator":              97,
-	"golden plasma gun":       98,
-	"golden slugger":          99,
-	"golden splinter gun":     100,
-	"golden screwdriver":      101,
-	"golden bazooka":          102,
-	"golden assault rifle":    103,
-	"super disc gun":          104,
-	"heavy auto crossbow":     105,
-	"heavy assault rifle":     106,
-	"blood cannon":            107,
-	"dog spin attack":         108,
-	"dog missile":             109,
-	"incinerator":             110,
-	"super plasma cannon":     111,
-	"seeker pistol":           112,
-	"seeker shotgun":          113,
-	"eraser":                  114,
-	"guitar":                  115,
-	"bouncer smg":             116,
-	"bouncer shotgun":         117,
-	"hyper slugger":           118,
-	"super bazooka":           119,
-	"frog pistol":             120,
-	"black sword":             121,
-	"golden nuke launcher":    122,
-	"golden disc gun":         123,
-	"heavy grenade launcher":  124,
-	"gun gun":                 125,
-	"eggplant":                126,
-	"golden frog pistol":      127,
+import (
+	_ "embed" // for the default game data
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// gameDataVersion is the version of the game data format this build understands
+const gameDataVersion = 1
+
+//go:embed gamedata.json
+var defaultGameData []byte
+
+// Item is a single in-game weapon, character, crown, mutation or ultra mutation
+type Item struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Display string   `json:"display"`
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Ammo is the weapon's ammo type. Ex. `bullet`, `shell`, `melee`
+	Ammo string `json:"ammo,omitempty"`
+	// Area is the area the item is unlocked or first found in
+	Area   string `json:"area,omitempty"`
+	Golden bool   `json:"golden,omitempty"`
+	Ultra  bool   `json:"ultra,omitempty"`
+
+	// Char is the name of the character an ultra mutation belongs to
+	Char string `json:"char,omitempty"`
+}
+
+// GameData is the contents of a game data file
+type GameData struct {
+	Version    int     `json:"version"`
+	Patch      string  `json:"patch"`
+	Characters []*Item `json:"characters"`
+	Ultras     []*Item `json:"ultras"`
+	Weapons    []*Item `json:"weapons"`
+	Crowns     []*Item `json:"crowns"`
+	Mutations  []*Item `json:"mutations"`
+}
+
+type itemMap struct {
+	items  []*Item
+	byName map[string]*Item
+	byID   map[int]*Item
+}
+
+func newItemMap(kind string, items []*Item) (*itemMap, error) {
+	m := &itemMap{
+		items:  items,
+		byName: make(map[string]*Item, len(items)),
+		byID:   make(map[int]*Item, len(items)),
+	}
+
+	for _, it := range items {
+		if it.Name == "" {
+			return nil, fmt.Errorf("gamedata: %s with ID %d has no name", kind, it.ID)
+		}
+
+		if _, ok := m.byID[it.ID]; ok {
+			return nil, fmt.Errorf("gamedata: duplicate %s ID %d", kind, it.ID)
+		}
+
+		if _, ok := m.byName[it.Name]; ok {
+			return nil, fmt.Errorf("gamedata: duplicate %s name %q", kind, it.Name)
+		}
+
+		if it.Display == "" {
+			it.Display = it.Name
+		}
+
+		m.byID[it.ID] = it
+		m.byName[it.Name] = it
+	}
+
+	return m, nil
+}
+
+var (
+	// Patch is the game version the loaded game data is for
+	Patch string
+
+	// Weapons is a map of in-game weapons with their corresponding IDs
+	Weapons *itemMap
+
+	// Mutations is a map of in-game mutations with their corresponding IDs
+	Mutations *itemMap
+
+	// Chars is a map of in-game characters and their corresponding IDs
+	Chars *itemMap
+
+	// Crowns is a map of in-game crowns with their corresponding IDs
+	Crowns *itemMap
+
+	// Ultras is a map of every character's ultra mutations with their corresponding IDs
+	Ultras *itemMap
+)
+
+func init() {
+	if err := setGameData(defaultGameData); err != nil {
+		panic(err)
+	}
+}
+
+// LoadGameData replaces the embedded game data with the contents of the file at path.
+// It must be called before the bot starts handling commands.
+func LoadGameData(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return setGameData(b)
+}
+
+func setGameData(b []byte) error {
+	var gd GameData
+	if err := json.Unmarshal(b, &gd); err != nil {
+		return fmt.Errorf("gamedata: %v", err)
+	}
+
+	if gd.Version != gameDataVersion {
+		return fmt.Errorf("gamedata: unsupported version %d, expected %d", gd.Version, gameDataVersion)
+	}
+
+	chars, err := newItemMap("character", gd.Characters)
+	if err != nil {
+		return err
+	}
+
+	weapons, err := newItemMap("weapon", gd.Weapons)
+	if err != nil {
+		return err
+	}
+
+	crowns, err := newItemMap("crown", gd.Crowns)
+	if err != nil {
+		return err
+	}
+
+	mutations, err := newItemMap("mutation", gd.Mutations)
+	if err != nil {
+		return err
+	}
+
+	ultras, err := newItemMap("ultra mutation", gd.Ultras)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range gd.Ultras {
+		if _, ok := chars.Get(u.Char); !ok {
+			return fmt.Errorf("gamedata: ultra mutation %q belongs to unknown character %q", u.Name, u.Char)
+		}
+	}
+
+	charRes, err := newResolver("character", chars)
+	if err != nil {
+		return err
+	}
+
+	weaponRes, err := newResolver("weapon", weapons)
+	if err != nil {
+		return err
+	}
+
+	crownRes, err := newResolver("crown", crowns, "crown of")
+	if err != nil {
+		return err
+	}
+
+	mutationRes, err := newResolver("mutation", mutations)
+	if err != nil {
+		return err
+	}
+
+	ultraRes, err := newResolver("ultra mutation", ultras, "ultra")
+	if err != nil {
+		return err
+	}
+
+	Patch, Chars, Weapons, Crowns, Mutations, Ultras = gd.Patch, chars, weapons, crowns, mutations, ultras
+	CharResolver, WeaponResolver, CrownResolver, MutationResolver, UltraResolver = charRes, weaponRes, crownRes, mutationRes, ultraRes
+	return nil
+}
+
+// UltrasFor returns the ultra mutations of the character with the given name
+func UltrasFor(char string) []*Item {
+	var res []*Item
+	for _, u := range Ultras.Items() {
+		if u.Char == char {
+			res = append(res, u)
+		}
+	}
+	return res
 }
 
-// Mutations is a map of in-game mutations with their corresponding IDs
-var Mutations = itemMap{
-	"none":              0,
-	"rhino skin":        1,
-	"extra feet":        2,
-	"plutonium hunger":  3,
-	"rabbit paw":        4,
-	"throne butt":       5,
-	"lucky shot":        6,
-	"bloodlust":         7,
-	"gamma guts":        8,
-	"second stomach":    9,
-	"back muscle":       10,
-	"scarier face":      11,
-	"euphoria":          12,
-	"long arms":         13,
-	"boiling veins":     14,
-	"shotgun shoulders": 15,
-	"recycle gland":     16,
-	"laser brain":       17,
-	"last wish":         18,
-	"eagle eyes":        19,
-	"impact wrists":     20,
-	"bolt marrow":       21,
-	"stress":            22,
-	"trigger fingers":   23,
-	"sharp teeth":       24,
-	"patience":          25,
-	"hammerhead":        26,
-	"strong spirit":     27,
-	"open mind":         28,
-	"heavy heart":       29,
+// Get returns the item with the given name
+func (m *itemMap) Get(name string) (*Item, bool) {
+	it, ok := m.byName[name]
+	return it, ok
 }
 
-// Chars is a map of in-game characters and their corresponding IDs
-var Chars = itemMap{
-	"random":   0,
-	"fish":     1,
-	"crystal":  2,
-	"eyes":     3,
-	"melting":  4,
-	"plant":    5,
-	"venuz":    6,
-	"steroids": 7,
-	"robot":    8,
-	"chicken":  9,
-	"rebel":    10,
-	"horror":   11,
-	"rogue":    12,
-	"bigdog":   13,
-	"skeleton": 14,
-	"frog":     15,
+// ByID returns the item with the given ID
+func (m *itemMap) ByID(id int) (*Item, bool) {
+	it, ok := m.byID[id]
+	return it, ok
 }
 
-// Crowns is a map of in-game crowns with their corresponding IDs
-var Crowns = itemMap{
-	"random":     0,
-	"none":       1,
-	"death":      2,
-	"life":       3,
-	"haste":      4,
-	"guns":       5,
-	"hatred":     6,
-	"blood":      7,
-	"destiny":    8,
-	"love":       9,
-	"luck":       10,
-	"curses":     11,
-	"risk":       12,
-	"protection": 13,
+// Items returns every item in the order of the data file
+func (m *itemMap) Items() []*Item {
+	return m.items
 }
 
 // NameToID returns the ID of the thing
-func (m itemMap) NameToID(name string) int {
-	if i, ok := m[name]; ok {
-		return i
+func (m *itemMap) NameToID(name string) int {
+	if it, ok := m.byName[name]; ok {
+		return it.ID
 	}
 	return -1
 }
 
 // IDToName returns the name of the ID
-func (m itemMap) IDToName(id int) string {
-	for k, v := range m {
-		if v == id {
-			return k
-		}
+func (m *itemMap) IDToName(id int) string {
+	if it, ok := m.byID[id]; ok {
+		return it.Name
 	}
 	return ""
 }
+
+// Display returns the display name of the item with the given name
+func (m *itemMap) Display(name string) string {
+	if it, ok := m.byName[name]; ok {
+		return it.Display
+	}
+	return name
+}
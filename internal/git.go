@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// githubRepo matches the `owner/repo` shorthand for GitHub repositories
+var githubRepo = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+// GitRemote returns the URL of an archive repository. The `owner/repo` shorthand is a GitHub repository,
+// anything else, like a path to a local bare repository, is passed to git as is.
+func GitRemote(repo string) string {
+	if githubRepo.MatchString(repo) {
+		if _, err := os.Stat(repo); err != nil {
+			return "https://github.com/" + strings.TrimSuffix(repo, ".git") + ".git"
+		}
+	}
+	return repo
+}
+
+// githubURL matches the URLs of GitHub repositories
+var githubURL = regexp.MustCompile(`^https://github\.com/([\w.-]+/[\w.-]+?)(\.git)?$`)
+
+// GitBackend is an ArchiveBackend which commits to a git repository and pushes to its remote.
+// It shells out to the git command, which must be installed.
+type GitBackend struct {
+	// Remote is the URL or path of the repository
+	Remote string
+	// Dir is where the repository is cloned to. The bot owns the clone, local changes are discarded.
+	Dir string
+	// Token authenticates with GitHub over HTTPS, if set
+	Token string
+	// Name and Email are the author of the commits
+	Name  string
+	Email string
+
+	mu sync.Mutex
+}
+
+var _ ArchiveBackend = (*GitBackend)(nil)
+
+// git runs a git command in the clone and returns its output
+func (g *GitBackend) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	// Passed through the environment rather than -c so the token doesn't show up in `ps`
+	if g.Token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + g.Token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Sync clones the repository, or resets the clone to the remote's latest commit
+func (g *GitBackend) Sync() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); os.IsNotExist(err) {
+		if err = os.MkdirAll(g.Dir, 0755); err != nil {
+			return err
+		}
+		_, err = g.git("clone", "--quiet", g.Remote, ".")
+		return err
+	}
+
+	if _, err := g.git("fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+
+	// A repository which was empty when it was cloned has nothing to reset to until the first push
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "@{upstream}"); err != nil {
+		return nil
+	}
+
+	_, err := g.git("reset", "--quiet", "--hard", "@{upstream}")
+	return err
+}
+
+// ReadFile returns the file at p in the commit of the last Sync, or nil if it doesn't exist
+func (g *GitBackend) ReadFile(p string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, err := os.ReadFile(filepath.Join(g.Dir, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// URL returns a link to the file at p on GitHub, or "" if the remote isn't a GitHub repository
+func (g *GitBackend) URL(p string) string {
+	m := githubURL.FindStringSubmatch(g.Remote)
+	if m == nil {
+		return ""
+	}
+	return "https://github.com/" + m[1] + "/blob/HEAD/" + p
+}
+
+// Commit writes the files on top of the commit of the last Sync, commits them and pushes the commit.
+// It reports whether any file changed.
+func (g *GitBackend) Commit(files map[string][]byte, message string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for p, b := range files {
+		if path.IsAbs(p) || path.Clean(p) != p || strings.HasPrefix(p, "../") {
+			return false, errors.New("git: invalid archive path " + p)
+		}
+
+		name := filepath.Join(g.Dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return false, err
+		}
+
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := g.git("add", "--all"); err != nil {
+		return false, err
+	}
+
+	// diff exits with 1 if there are staged changes
+	if _, err := g.git("diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+
+	name, email := g.Name, g.Email
+	if name == "" {
+		name = "thronebot"
+	}
+
+	if email == "" {
+		email = "thronebot@users.noreply.github.com"
+	}
+
+	if _, err := g.git("-c", "user.name="+name, "-c", "user.email="+email, "commit", "--quiet", "-m", message); err != nil {
+		return false, err
+	}
+
+	// A commit which fails to push is discarded by the next sync
+	if _, err := g.git("push", "--quiet", "--set-upstream", "origin", "HEAD"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// gitOutput runs git in dir and returns its trimmed output
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "archive.git")
+	gitOutput(t, dir, "init", "--quiet", "--bare", remote)
+
+	ses, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Archiver{
+		Ses:     ses,
+		Backend: &GitBackend{Remote: remote, Dir: filepath.Join(dir, "clone"), Name: "tester", Email: "tester@example.com"},
+	}
+
+	ch := &discordgo.Channel{ID: "c1", GuildID: "g1", Name: "general"}
+	day := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	pins := []*Pin{
+		{ID: "p1", AuthorID: "u1", Author: "one#0001", Content: "first", Timestamp: day},
+		{ID: "p2", AuthorID: "u2", Author: "two#0002", Content: "second", Timestamp: day.Add(time.Hour)},
+	}
+
+	c, changed, err := a.archive(ch, pins, FormatMarkdown, "tester#0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || len(c.Pins) != 2 {
+		t.Fatalf("first archive changed = %v with %d pins, want true with 2", changed, len(c.Pins))
+	}
+
+	files := gitOutput(t, remote, "ls-tree", "-r", "--name-only", "HEAD")
+	want := []string{"g1/c1.json", "g1/c1.md", "index.json", "index.md"}
+	if got := strings.Split(files, "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("committed files = %q, want %q", got, want)
+	}
+
+	msg := gitOutput(t, remote, "log", "-1", "--format=%an <%ae>%n%B")
+	if want := "tester <tester@example.com>\nArchive 2 pins from #general\n\nArchived by tester#0001"; msg != want {
+		t.Errorf("commit = %q, want %q", msg, want)
+	}
+
+	var archived ChannelArchive
+	if err = json.Unmarshal([]byte(gitOutput(t, remote, "show", "HEAD:g1/c1.json")), &archived); err != nil {
+		t.Fatal(err)
+	}
+	if archived.Name != "general" || len(archived.Pins) != 2 || archived.Pins[0].Content != "first" || archived.Pins[1].Content != "second" {
+		t.Errorf("archived %+v, want #general with the pins first and second", archived)
+	}
+
+	md := gitOutput(t, remote, "show", "HEAD:g1/c1.md")
+	if !strings.Contains(md, "first") || !strings.Contains(md, "second") {
+		t.Errorf("markdown archive is missing pins:\n%s", md)
+	}
+
+	// Archiving the same pins again changes nothing
+	if _, changed, err = a.archive(ch, pins, FormatMarkdown, "tester#0001"); err != nil || changed {
+		t.Errorf("archiving again changed = %v, %v, want false", changed, err)
+	}
+
+	// Pins which were unpinned since stay archived
+	third := &Pin{ID: "p3", AuthorID: "u1", Author: "one#0001", Content: "third", Timestamp: day.Add(2 * time.Hour)}
+	if c, changed, err = a.archive(ch, []*Pin{third}, FormatMarkdown, "tester#0001"); err != nil || !changed || len(c.Pins) != 3 {
+		t.Errorf("archiving a new pin changed = %v with %d pins, %v, want true with 3", changed, len(c.Pins), err)
+	}
+
+	if n := gitOutput(t, remote, "rev-list", "--count", "HEAD"); n != "2" {
+		t.Errorf("remote has %s commits, want 2", n)
+	}
+}
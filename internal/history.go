@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Krognol/thronebot/internal/router"
+	"github.com/bwmarrin/discordgo"
+)
+
+// HistoryEntry is a weekly that has been set on Thronebutt
+type HistoryEntry struct {
+	Build
+	SetBy string
+	SetAt time.Time
+}
+
+// WeeklyHistoryHandler returns a router handler which prints the most recent weeklies
+func WeeklyHistoryHandler(store WeeklyStore) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		entries, err := store.History(ctx.Values.Int("n", 5))
+		if err != nil {
+			log.Println("weeklyHistory:", err)
+			ctx.Reply("Failed to retrieve weekly history.")
+			return
+		}
+
+		if len(entries) == 0 {
+			ctx.Reply("No weeklies have been set yet.")
+			return
+		}
+
+		var buf strings.Builder
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "`%s` %s, set by <@%s>\n", e.SetAt.Format("2006-01-02"), e.Build.String(), e.SetBy)
+		}
+
+		ctx.ReplyEmbed(&discordgo.MessageEmbed{
+			Title:       "Previous weeklies",
+			Description: buf.String(),
+		})
+	}
+}
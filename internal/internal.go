@@ -1,24 +1,25 @@
 package internal
 
 import (
-	"database/sql"
-
 	"github.com/Krognol/thronebot/internal/router"
 	"github.com/bwmarrin/discordgo"
 )
 
 // Bot ...
 type Bot struct {
-	Ses   *discordgo.Session
-	DB    *sql.DB
-	Route *router.Route
+	Ses      *discordgo.Session
+	DB       *DB
+	Store    WeeklyStore
+	Route    *router.Route
+	Settings *Settings
 }
 
 // NewBot returns a new Discord bot
-func NewBot(ses *discordgo.Session, db *sql.DB, route *router.Route) *Bot {
+func NewBot(ses *discordgo.Session, db *DB, route *router.Route) *Bot {
 	return &Bot{
 		Ses:   ses,
 		DB:    db,
+		Store: NewSQLStore(db),
 		Route: route,
 	}
 }
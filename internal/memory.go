@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a WeeklyStore which keeps everything in memory. It's meant for tests and
+// trying the bot out, everything is lost when the process exits.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	nextID      int64
+	suggestions map[int64]*Suggestion
+	messages    map[string]int64
+	counts      map[string]int
+	archive     []*ArchivedSuggestion
+	lastCycle   time.Time
+	bans        map[banKey]*Ban
+	history     []*HistoryEntry
+}
+
+// ArchivedSuggestion is a suggestion from a closed week
+type ArchivedSuggestion struct {
+	Suggestion
+	Week   string
+	Winner bool
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		suggestions: make(map[int64]*Suggestion),
+		messages:    make(map[string]int64),
+		counts:      make(map[string]int),
+		bans:        make(map[banKey]*Ban),
+	}
+}
+
+var _ WeeklyStore = (*MemoryStore)(nil)
+
+// Ping always succeeds
+func (m *MemoryStore) Ping() error { return nil }
+
+// SuggestionCount returns how many suggestions the user has made this week
+func (m *MemoryStore) SuggestionCount(uid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[uid], nil
+}
+
+// InsertSuggestion stores a suggestion, increments the user's suggestion count and returns the suggestion's ID
+func (m *MemoryStore) InsertSuggestion(uid string, b *Build) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	s := &Suggestion{ID: m.nextID, UserID: uid, Build: *b}
+	s.Mutations = append([]string(nil), b.Mutations...)
+
+	m.suggestions[s.ID] = s
+	m.counts[uid]++
+	return s.ID, nil
+}
+
+// SetSuggestionMessage stores the ID of the voting message posted for a suggestion
+func (m *MemoryStore) SetSuggestionMessage(id int64, messageID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[messageID] = id
+	return nil
+}
+
+// UpdateVotes adds delta to the up or down vote count of the suggestion posted as messageID
+func (m *MemoryStore) UpdateVotes(messageID string, up bool, delta int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.suggestions[m.messages[messageID]]
+	if !ok {
+		return nil
+	}
+
+	if up {
+		s.Up += delta
+	} else {
+		s.Down += delta
+	}
+	return nil
+}
+
+// copySuggestion returns a copy of s the caller can modify without holding the lock
+func copySuggestion(s *Suggestion) *Suggestion {
+	c := *s
+	c.Mutations = append([]string(nil), s.Mutations...)
+	return &c
+}
+
+// Suggestions returns this week's suggestions ordered by their net votes, highest first
+func (m *MemoryStore) Suggestions() ([]*Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sorted(), nil
+}
+
+// sorted returns copies of the suggestions ordered like Suggestions. The caller must hold the lock.
+func (m *MemoryStore) sorted() []*Suggestion {
+	var res []*Suggestion
+	for _, s := range m.suggestions {
+		res = append(res, copySuggestion(s))
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Score() != b.Score() {
+			return a.Score() > b.Score()
+		}
+
+		if a.Up != b.Up {
+			return a.Up > b.Up
+		}
+		return a.ID < b.ID
+	})
+	return res
+}
+
+// Suggestion returns the suggestion with the given ID, or nil if there is none
+func (m *MemoryStore) Suggestion(id int64) (*Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.suggestions[id]; ok {
+		return copySuggestion(s), nil
+	}
+	return nil, nil
+}
+
+// CloseWeek archives this week's suggestions under week with the first one as the winner, clears them
+// and their votes, resets every user's suggestion count and records now as the time of the last weekly cycle
+func (m *MemoryStore) CloseWeek(week string, now time.Time) ([]*Suggestion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !now.After(m.lastCycle) {
+		return nil, ErrWeekClosed
+	}
+
+	suggestions := m.sorted()
+	for i, s := range suggestions {
+		m.archive = append(m.archive, &ArchivedSuggestion{
+			Suggestion: *copySuggestion(s),
+			Week:       week,
+			Winner:     i == 0,
+		})
+		delete(m.suggestions, s.ID)
+	}
+
+	for msg, id := range m.messages {
+		if _, ok := m.suggestions[id]; !ok {
+			delete(m.messages, msg)
+		}
+	}
+
+	for uid := range m.counts {
+		m.counts[uid] = 0
+	}
+
+	m.lastCycle = now.UTC()
+	return suggestions, nil
+}
+
+// Archive returns every archived suggestion in the order they were archived
+func (m *MemoryStore) Archive() []*ArchivedSuggestion {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*ArchivedSuggestion(nil), m.archive...)
+}
+
+// LastCycle returns when the weekly cycle last ran, or the zero time if it never has
+func (m *MemoryStore) LastCycle() (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastCycle, nil
+}
+
+// SetLastCycle records when the weekly cycle last ran
+func (m *MemoryStore) SetLastCycle(t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastCycle = t.UTC()
+	return nil
+}
+
+// AddBan bans an item for the weekly. Banning an already banned item replaces the old ban.
+func (m *MemoryStore) AddBan(b *Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *b
+	m.bans[banKey{b.Kind, b.ItemID}] = &c
+	return nil
+}
+
+// DelBan removes an item from the banned list. It reports whether the item was banned.
+func (m *MemoryStore) DelBan(kind BanKind, itemID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := banKey{kind, itemID}
+	_, ok := m.bans[k]
+	delete(m.bans, k)
+	return ok, nil
+}
+
+// Bans returns every ban which is active at now, ordered by kind and item ID
+func (m *MemoryStore) Bans(now time.Time) ([]*Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*Ban
+	for _, b := range m.bans {
+		if b.activeAt(now) {
+			c := *b
+			res = append(res, &c)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].ItemID < res[j].ItemID
+	})
+	return res, nil
+}
+
+// IsBanned checks if one or more items of the build are banned at now
+func (m *MemoryStore) IsBanned(b *Build, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range banKeys(b) {
+		if ban, ok := m.bans[k]; ok && ban.activeAt(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PruneExpiredBans removes every ban which expired at or before now and returns them
+func (m *MemoryStore) PruneExpiredBans(now time.Time) ([]*Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*Ban
+	for k, b := range m.bans {
+		if !b.activeAt(now) {
+			res = append(res, b)
+			delete(m.bans, k)
+		}
+	}
+	return res, nil
+}
+
+// InsertHistory records a weekly as set by the user with ID setBy
+func (m *MemoryStore) InsertHistory(b *Build, setBy string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &HistoryEntry{Build: *b, SetBy: setBy, SetAt: at.UTC()}
+	e.Mutations = append([]string(nil), b.Mutations...)
+	m.history = append(m.history, e)
+	return nil
+}
+
+// History returns the n most recently set weeklies, newest first
+func (m *MemoryStore) History(n int) ([]*HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*HistoryEntry
+	for i := len(m.history) - 1; i >= 0 && len(res) < n; i-- {
+		e := *m.history[i]
+		res = append(res, &e)
+	}
+	return res, nil
+}
+
+// LastPlayed returns when a weekly with the same character, weapon and crown as b was last set.
+// The returned time is zero if it has never been played.
+func (m *MemoryStore) LastPlayed(b *Build) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if e := m.history[i]; e.Char == b.Char && e.Weap == b.Weap && e.Crown == b.Crown {
+			return e.SetAt, nil
+		}
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mirror downloads the attachments and embed images of archived pins into the archive, so the archive
+// keeps working once Discord's CDN links die. Files are stored by the SHA-256 of their content,
+// so a file pinned more than once is only stored once.
+type Mirror struct {
+	// Client downloads the files, http.DefaultClient with a timeout if nil
+	Client *http.Client
+	// MaxSize is the size of the largest file that is mirrored, in bytes. Larger files keep their original link.
+	MaxSize int64
+	// MaxTotal is how many bytes are mirrored at most each time pins are archived. The rest are mirrored
+	// the next time the channel is archived.
+	MaxTotal int64
+
+	mu sync.Mutex
+	// tooLarge holds the URLs of files larger than MaxSize, so they aren't downloaded again
+	tooLarge map[string]bool
+}
+
+var errTooLarge = errors.New("file is too large to mirror")
+
+// mirrorDir is the directory of mirrored files in the archive
+const mirrorDir = "files"
+
+// urls returns the URLs of the pin's files which can be mirrored
+func (p *Pin) urls() []string {
+	var res []string
+	for _, a := range p.Attachments {
+		res = append(res, a.URL)
+	}
+
+	for _, e := range p.Embeds {
+		if e.Image != nil && e.Image.URL != "" {
+			res = append(res, e.Image.URL)
+		}
+
+		if e.Thumbnail != nil && e.Thumbnail.URL != "" {
+			res = append(res, e.Thumbnail.URL)
+		}
+	}
+	return res
+}
+
+// mirror downloads every file of the pins which hasn't been mirrored yet and adds it to files.
+// Files which fail to download are logged and tried again the next time, files which are too large aren't.
+func (m *Mirror) mirror(pins []*Pin, files map[string][]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := int64(0)
+	// done holds the files mirrored by this call by URL, for the same file pinned more than once
+	done := make(map[string]string)
+	for _, p := range pins {
+		for _, u := range p.urls() {
+			if _, ok := p.Mirrored[u]; ok || m.tooLarge[u] {
+				continue
+			}
+
+			local, ok := done[u]
+			if !ok {
+				if m.MaxTotal > 0 && total >= m.MaxTotal {
+					return
+				}
+
+				b, err := m.download(u)
+				if err == errTooLarge {
+					if m.tooLarge == nil {
+						m.tooLarge = make(map[string]bool)
+					}
+					m.tooLarge[u] = true
+					continue
+				}
+
+				if err != nil {
+					log.Println("mirror: failed to download", u, ":", err)
+					continue
+				}
+
+				sum := sha256.Sum256(b)
+				name := hex.EncodeToString(sum[:])
+				local = path.Join(mirrorDir, name[:2], name+mirrorExt(u))
+				done[u] = local
+
+				if _, ok := files[local]; !ok {
+					files[local] = b
+					total += int64(len(b))
+				}
+			}
+
+			if p.Mirrored == nil {
+				p.Mirrored = make(map[string]string)
+			}
+			p.Mirrored[u] = local
+		}
+	}
+}
+
+// download returns the file at u, or errTooLarge if it's larger than MaxSize
+func (m *Mirror) download(u string) ([]byte, error) {
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+
+	res, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	if m.MaxSize > 0 && res.ContentLength > m.MaxSize {
+		return nil, errTooLarge
+	}
+
+	r := io.Reader(res.Body)
+	if m.MaxSize > 0 {
+		r = io.LimitReader(r, m.MaxSize+1)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.MaxSize > 0 && int64(len(b)) > m.MaxSize {
+		return nil, errTooLarge
+	}
+	return b, nil
+}
+
+// mirrorExt returns the file extension of the URL u, so mirrored files open in the right program
+func mirrorExt(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	ext := strings.ToLower(path.Ext(pu.Path))
+	if len(ext) > 8 || strings.ContainsAny(ext, `/\`) {
+		return ""
+	}
+	return ext
+}
+
+// Src returns the link to the file at u of the pin from a page of the channel, which is the mirrored copy
+// if there is one
+func (c *ChannelArchive) Src(p *Pin, u string) string {
+	if local, ok := p.Mirrored[u]; ok {
+		return "../" + local
+	}
+	return u
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fileServer serves files by path and counts the requests for each of them. Files in chunked are sent
+// without a Content-Length.
+type fileServer struct {
+	files   map[string]string
+	chunked map[string]bool
+
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func (f *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.hits[r.URL.Path]++
+	f.mu.Unlock()
+
+	b, ok := f.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if f.chunked[r.URL.Path] {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+	}
+	w.Write([]byte(b))
+}
+
+func (f *fileServer) hit(p string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits[p]
+}
+
+func newFileServer(t *testing.T, files map[string]string, chunked ...string) (*fileServer, *httptest.Server) {
+	f := &fileServer{files: files, chunked: make(map[string]bool), hits: make(map[string]int)}
+	for _, p := range chunked {
+		f.chunked[p] = true
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// mirrorName is where a file with the content b is mirrored
+func mirrorName(b, ext string) string {
+	sum := sha256.Sum256([]byte(b))
+	name := hex.EncodeToString(sum[:])
+	return "files/" + name[:2] + "/" + name + ext
+}
+
+func attachmentPin(id string, urls ...string) *Pin {
+	p := &Pin{ID: id}
+	for _, u := range urls {
+		p.Attachments = append(p.Attachments, &PinAttachment{URL: u})
+	}
+	return p
+}
+
+func TestMirror(t *testing.T) {
+	f, srv := newFileServer(t, map[string]string{
+		"/a.png":     "image a",
+		"/copy.PNG":  "image a",
+		"/b.gif":     "image b",
+		"/thumb.jpg": "thumbnail",
+		"/big.png":   strings.Repeat("x", 100),
+		"/chunk.png": strings.Repeat("y", 100),
+	}, "/chunk.png")
+
+	m := &Mirror{Client: srv.Client(), MaxSize: 50}
+	pins := []*Pin{
+		attachmentPin("1", srv.URL+"/a.png", srv.URL+"/big.png"),
+		attachmentPin("2", srv.URL+"/a.png", srv.URL+"/copy.PNG", srv.URL+"/missing.png"),
+		attachmentPin("3", srv.URL+"/chunk.png"),
+		{ID: "4", Embeds: []*discordgo.MessageEmbed{{
+			Image:     &discordgo.MessageEmbedImage{URL: srv.URL + "/b.gif?width=100"},
+			Thumbnail: &discordgo.MessageEmbedThumbnail{URL: srv.URL + "/thumb.jpg"},
+		}}},
+	}
+
+	files := make(map[string][]byte)
+	m.mirror(pins, files)
+
+	a, b, thumb := mirrorName("image a", ".png"), mirrorName("image b", ".gif"), mirrorName("thumbnail", ".jpg")
+	want := map[string]string{a: "image a", b: "image b", thumb: "thumbnail"}
+	if len(files) != len(want) {
+		t.Errorf("mirrored %d files, want %d", len(files), len(want))
+	}
+
+	for name, content := range want {
+		if string(files[name]) != content {
+			t.Errorf("%s is %q, want %q", name, files[name], content)
+		}
+	}
+
+	c := new(ChannelArchive)
+	for _, l := range []struct {
+		p    *Pin
+		u    string
+		want string
+	}{
+		{pins[0], srv.URL + "/a.png", "../" + a},
+		{pins[1], srv.URL + "/a.png", "../" + a},
+		{pins[1], srv.URL + "/copy.PNG", "../" + a},
+		{pins[3], srv.URL + "/b.gif?width=100", "../" + b},
+		{pins[3], srv.URL + "/thumb.jpg", "../" + thumb},
+
+		// Files which are too large or failed to download keep their link
+		{pins[0], srv.URL + "/big.png", srv.URL + "/big.png"},
+		{pins[2], srv.URL + "/chunk.png", srv.URL + "/chunk.png"},
+		{pins[1], srv.URL + "/missing.png", srv.URL + "/missing.png"},
+	} {
+		if got := c.Src(l.p, l.u); got != l.want {
+			t.Errorf("pin %s: %s links to %q, want %q", l.p.ID, l.u, got, l.want)
+		}
+	}
+
+	// Mirrored and oversized files aren't downloaded again, failed downloads are
+	m.mirror(pins, files)
+	for p, n := range map[string]int{"/a.png": 1, "/big.png": 1, "/chunk.png": 1, "/missing.png": 2} {
+		if got := f.hit(p); got != n {
+			t.Errorf("%s was requested %d times, want %d", p, got, n)
+		}
+	}
+}
+
+func TestMirrorMaxTotal(t *testing.T) {
+	_, srv := newFileServer(t, map[string]string{
+		"/1.png": "0123456789",
+		"/2.png": "abcdefghij",
+		"/3.png": "klmnopqrst",
+	})
+
+	m := &Mirror{Client: srv.Client(), MaxTotal: 15}
+	pins := []*Pin{attachmentPin("1", srv.URL+"/1.png", srv.URL+"/2.png"), attachmentPin("2", srv.URL+"/3.png")}
+
+	// The file which crosses MaxTotal is mirrored, the rest wait for the next time
+	files := make(map[string][]byte)
+	m.mirror(pins, files)
+	if len(files) != 2 || len(pins[0].Mirrored) != 2 || len(pins[1].Mirrored) != 0 {
+		t.Fatalf("mirrored %d files, %v, %v, want the first 2", len(files), pins[0].Mirrored, pins[1].Mirrored)
+	}
+
+	files = make(map[string][]byte)
+	m.mirror(pins, files)
+	if name := mirrorName("klmnopqrst", ".png"); len(files) != 1 || files[name] == nil || pins[1].Mirrored[srv.URL+"/3.png"] != name {
+		t.Errorf("mirrored %d files, %v the next time, want %s", len(files), pins[1].Mirrored, name)
+	}
+}
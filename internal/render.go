@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ArchiveFormat is a format archived pins are rendered in
+type ArchiveFormat string
+
+// Archive formats. JSON is the archive's data and is always written, the other formats are rendered from it.
+const (
+	FormatMarkdown ArchiveFormat = "markdown"
+	FormatHTML     ArchiveFormat = "html"
+	FormatJSON     ArchiveFormat = "json"
+)
+
+// ArchiveFormats lists every archive format
+var ArchiveFormats = []ArchiveFormat{FormatMarkdown, FormatHTML, FormatJSON}
+
+// ParseArchiveFormat parses the name of an archive format. `md` is short for markdown.
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	switch f := ArchiveFormat(strings.ToLower(s)); f {
+	case FormatMarkdown, FormatHTML, FormatJSON:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	}
+	return "", errors.New("unknown archive format `" + s + "`, expected markdown, html or json")
+}
+
+// Ext returns the file extension of the format
+func (f ArchiveFormat) Ext() string {
+	switch f {
+	case FormatHTML:
+		return ".html"
+	case FormatJSON:
+		return ".json"
+	}
+	return ".md"
+}
+
+// render renders the channel archive in the format
+func (f ArchiveFormat) render(c *ChannelArchive) ([]byte, error) {
+	switch f {
+	case FormatHTML:
+		return executeTemplate(channelHTML, c)
+	case FormatJSON:
+		return marshalArchive(c)
+	}
+	return c.Markdown(), nil
+}
+
+// renderIndex renders the index in the format
+func (f ArchiveFormat) renderIndex(idx *ArchiveIndex) ([]byte, error) {
+	switch f {
+	case FormatHTML:
+		return executeTemplate(indexHTML, idx.view(f))
+	case FormatJSON:
+		return marshalArchive(idx)
+	}
+	return idx.Markdown(), nil
+}
+
+func marshalArchive(v interface{}) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// ArchiveIndex lists every archived channel
+type ArchiveIndex struct {
+	Channels []*IndexEntry `json:"channels"`
+}
+
+// IndexEntry is an archived channel and the formats it's been rendered in
+type IndexEntry struct {
+	GuildID   string          `json:"guild_id"`
+	Guild     string          `json:"guild,omitempty"`
+	ChannelID string          `json:"channel_id"`
+	Name      string          `json:"name"`
+	Pins      int             `json:"pins"`
+	Formats   []ArchiveFormat `json:"formats"`
+}
+
+// indexPath is where the index is stored in the format
+func indexPath(f ArchiveFormat) string {
+	return "index" + f.Ext()
+}
+
+// update records that c has been rendered in the format
+func (idx *ArchiveIndex) update(c *ChannelArchive, f ArchiveFormat) {
+	var e *IndexEntry
+	for _, ie := range idx.Channels {
+		if ie.ChannelID == c.ChannelID {
+			e = ie
+			break
+		}
+	}
+
+	if e == nil {
+		e = &IndexEntry{GuildID: c.GuildID, ChannelID: c.ChannelID}
+		idx.Channels = append(idx.Channels, e)
+	}
+
+	e.Name, e.Pins = c.Name, len(c.Pins)
+	if c.Guild != "" {
+		e.Guild = c.Guild
+	}
+
+	if !e.has(f) {
+		e.Formats = append(e.Formats, f)
+	}
+
+	sort.SliceStable(idx.Channels, func(i, j int) bool {
+		a, b := idx.Channels[i], idx.Channels[j]
+		if a.GuildID != b.GuildID {
+			return a.GuildID < b.GuildID
+		}
+		return a.Name < b.Name
+	})
+}
+
+// indexLink is a channel in the index page of a format
+type indexLink struct {
+	Guild string
+	Name  string
+	Pins  int
+	Path  string
+}
+
+// view returns the channels of the index with links to the file of each channel in the format,
+// or in the first format it was archived in if it hasn't been rendered in this one
+func (idx *ArchiveIndex) view(f ArchiveFormat) []*indexLink {
+	var res []*indexLink
+	for _, e := range idx.Channels {
+		lf := f
+		if !e.has(f) && len(e.Formats) > 0 {
+			lf = e.Formats[0]
+		}
+
+		guild := e.Guild
+		if guild == "" {
+			guild = e.GuildID
+		}
+
+		c := &ChannelArchive{GuildID: e.GuildID, ChannelID: e.ChannelID}
+		res = append(res, &indexLink{Guild: guild, Name: e.Name, Pins: e.Pins, Path: c.Path(lf)})
+	}
+	return res
+}
+
+// has reports whether any channel has been rendered in the format
+func (idx *ArchiveIndex) has(f ArchiveFormat) bool {
+	for _, e := range idx.Channels {
+		if e.has(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *IndexEntry) has(f ArchiveFormat) bool {
+	for _, ef := range e.Formats {
+		if ef == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Markdown renders the index as a Markdown document
+func (idx *ArchiveIndex) Markdown() []byte {
+	var buf strings.Builder
+	buf.WriteString("# Pin archive\n")
+
+	guild := ""
+	for _, l := range idx.view(FormatMarkdown) {
+		if l.Guild != guild {
+			guild = l.Guild
+			fmt.Fprintf(&buf, "\n## %s\n\n", guild)
+		}
+		fmt.Fprintf(&buf, "- [#%s](%s), %s\n", l.Name, l.Path, plural(l.Pins, "pin"))
+	}
+	return []byte(buf.String())
+}
+
+// Markdown renders the archive as a Markdown document
+func (c *ChannelArchive) Markdown() []byte {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# #%s\n\n", c.Name)
+	fmt.Fprintf(&buf, "%s.\n", plural(len(c.Pins), "archived pinned message"))
+
+	for _, p := range c.Pins {
+		fmt.Fprintf(&buf, "\n## %s, %s\n\n", p.Author, p.Timestamp.Format("2006-01-02 15:04 UTC"))
+		fmt.Fprintf(&buf, "[Jump to message](%s)\n", c.MessageURL(p))
+
+		if p.Content != "" {
+			buf.WriteString("\n> " + strings.ReplaceAll(p.Content, "\n", "\n> ") + "\n")
+		}
+
+		if len(p.Attachments) > 0 {
+			buf.WriteString("\nAttachments:\n\n")
+			for _, a := range p.Attachments {
+				fmt.Fprintf(&buf, "- [%s](%s)\n", a.Filename, c.Src(p, a.URL))
+			}
+		}
+
+		if len(p.Embeds) > 0 {
+			buf.WriteString("\nEmbeds:\n\n")
+			for _, e := range p.Embeds {
+				buf.WriteString("- " + c.embedMarkdown(p, e) + "\n")
+			}
+		}
+	}
+	return []byte(buf.String())
+}
+
+// embedMarkdown renders an embed of the pin as a single list item
+func (c *ChannelArchive) embedMarkdown(p *Pin, e *discordgo.MessageEmbed) string {
+	title := e.Title
+	if title == "" && e.Provider != nil {
+		title = e.Provider.Name
+	}
+
+	if title == "" {
+		title = e.URL
+	}
+
+	res := "**" + title + "**"
+	if e.URL != "" {
+		res = "[" + res + "](" + e.URL + ")"
+	}
+
+	if e.Description != "" {
+		res += ": " + strings.ReplaceAll(e.Description, "\n", " ")
+	}
+
+	if e.Image != nil && e.Image.URL != "" {
+		res += " ([image](" + c.Src(p, e.Image.URL) + "))"
+	} else if e.Thumbnail != nil && e.Thumbnail.URL != "" {
+		res += " ([thumbnail](" + c.Src(p, e.Thumbnail.URL) + "))"
+	}
+	return res
+}
+
+func executeTemplate(t *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var templateFuncs = template.FuncMap{
+	// color converts an embed color to CSS. Embeds without a color get Discord's default grey.
+	"color": func(c int) template.CSS {
+		if c == 0 {
+			return "#4f545c"
+		}
+		return template.CSS(fmt.Sprintf("#%06x", c&0xffffff))
+	},
+	"isImage": func(name string) bool {
+		switch strings.ToLower(path.Ext(name)) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+			return true
+		}
+		return false
+	},
+	// rel makes a path in the archive relative to the directory of a channel's page
+	"rel":    func(p string) string { return "../" + p },
+	"plural": plural,
+}
+
+// plural returns n and the noun, with an s unless n is 1
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// archiveCSS is shared by every HTML page so each one is self-contained
+const archiveCSS = `<style>
+body { margin: 0; padding: 16px 32px; background: #36393f; color: #dcddde; font: 16px/1.375 "Helvetica Neue", Helvetica, Arial, sans-serif; }
+a { color: #00aff4; text-decoration: none; }
+a:hover { text-decoration: underline; }
+h1 { color: #fff; font-size: 24px; }
+h2 { color: #8e9297; font-size: 12px; text-transform: uppercase; letter-spacing: .02em; margin-top: 24px; }
+.message { display: flex; padding: 8px 0; border-top: 1px solid #40444b; }
+.avatar { width: 40px; height: 40px; border-radius: 50%; margin-right: 16px; flex-shrink: 0; background: #7289da; }
+.body { min-width: 0; }
+.author { color: #fff; font-weight: 500; }
+.timestamp { color: #72767d; font-size: 12px; margin-left: 4px; }
+.content { white-space: pre-wrap; word-wrap: break-word; }
+.attachment img { max-width: 400px; max-height: 300px; border-radius: 3px; margin-top: 4px; }
+.embed { max-width: 520px; margin-top: 4px; padding: 8px 16px 16px 12px; background: #2f3136; border-left: 4px solid; border-radius: 4px; }
+.embed-provider { color: #b9bbbe; font-size: 12px; margin-top: 8px; }
+.embed-title { color: #fff; font-weight: 600; margin-top: 8px; }
+.embed-description { font-size: 14px; white-space: pre-wrap; margin-top: 8px; }
+.embed-field { font-size: 14px; margin-top: 8px; }
+.embed-field-name { color: #fff; font-weight: 600; }
+.embed img { max-width: 100%; border-radius: 4px; margin-top: 16px; }
+.embed-footer { color: #b9bbbe; font-size: 12px; margin-top: 8px; }
+.channels li { margin: 4px 0; }
+.count { color: #72767d; }
+</style>`
+
+var channelHTML = template.Must(template.New("channel").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>#{{.Name}} pins</title>
+` + archiveCSS + `
+</head>
+<body>
+<p><a href="{{rel "index.html"}}">All channels</a></p>
+<h1>#{{.Name}}</h1>
+<p class="count">{{plural (len .Pins) "archived pinned message"}}</p>
+{{range $pin := .Pins}}
+<div class="message" id="{{.ID}}">
+{{if .AuthorAvatar}}<img class="avatar" src="{{.AuthorAvatar}}" alt="">{{else}}<div class="avatar"></div>{{end}}
+<div class="body">
+<div><span class="author">{{.Author}}</span><a class="timestamp" href="{{$.MessageURL .}}">{{.Timestamp.Format "2006-01-02 15:04 UTC"}}</a></div>
+{{if .Content}}<div class="content">{{.Content}}</div>{{end}}
+{{range .Attachments}}<div class="attachment">{{if isImage .Filename}}<a href="{{$.Src $pin .URL}}"><img src="{{$.Src $pin .URL}}" alt="{{.Filename}}"></a>{{else}}<a href="{{$.Src $pin .URL}}">{{.Filename}}</a>{{end}}</div>
+{{end}}{{range .Embeds}}<div class="embed" style="border-color: {{color .Color}}">
+{{if .Provider}}{{if .Provider.Name}}<div class="embed-provider">{{.Provider.Name}}</div>{{end}}{{end}}
+{{if .Author}}{{if .Author.Name}}<div class="embed-provider">{{.Author.Name}}</div>{{end}}{{end}}
+{{if .Title}}<div class="embed-title">{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</div>{{end}}
+{{if .Description}}<div class="embed-description">{{.Description}}</div>{{end}}
+{{range .Fields}}<div class="embed-field"><div class="embed-field-name">{{.Name}}</div><div>{{.Value}}</div></div>{{end}}
+{{if .Image}}<img src="{{$.Src $pin .Image.URL}}" alt="">{{else if .Thumbnail}}<img src="{{$.Src $pin .Thumbnail.URL}}" alt="">{{end}}
+{{if .Footer}}<div class="embed-footer">{{.Footer.Text}}</div>{{end}}
+</div>
+{{end}}</div>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+var indexHTML = template.Must(template.New("index").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Pin archive</title>
+` + archiveCSS + `
+</head>
+<body>
+<h1>Pin archive</h1>
+{{$guild := ""}}{{range .}}{{if ne .Guild $guild}}{{if $guild}}</ul>
+{{end}}{{$guild = .Guild}}<h2>{{.Guild}}</h2>
+<ul class="channels">
+{{end}}<li><a href="{{.Path}}">#{{.Name}}</a> <span class="count">{{plural .Pins "pin"}}</span></li>
+{{end}}{{if $guild}}</ul>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenChannel is archived in every format by TestRenderGolden. It covers edits, attachments,
+// mirrored files, embeds and text which needs escaping.
+func goldenChannel() *ChannelArchive {
+	day := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	edited := day.Add(90 * time.Minute)
+
+	return &ChannelArchive{
+		GuildID:   "100",
+		Guild:     "Nuclear Throne",
+		ChannelID: "200",
+		Name:      "weekly",
+		Pins: []*Pin{
+			{
+				ID:           "300",
+				AuthorID:     "400",
+				Author:       "fish#0001",
+				AuthorAvatar: "https://cdn.discordapp.com/avatars/400/abc.png?size=64",
+				Content:      "New weekly: **steroids/b/gl/death** <script>alert(1)</script> & more",
+				Timestamp:    day,
+				Edited:       &edited,
+			},
+			{
+				ID:        "301",
+				AuthorID:  "401",
+				Author:    "crystal#0002",
+				Content:   "Run with a screenshot",
+				Timestamp: day.Add(24 * time.Hour),
+				Attachments: []*PinAttachment{
+					{ID: "500", Filename: "run.png", URL: "https://cdn.discordapp.com/attachments/200/500/run.png", Size: 2048, Width: 640, Height: 480},
+					{ID: "501", Filename: "notes.txt", URL: "https://cdn.discordapp.com/attachments/200/501/notes.txt", Size: 12},
+				},
+				Mirrored: map[string]string{
+					"https://cdn.discordapp.com/attachments/200/500/run.png": "files/0c1b2a.png",
+				},
+			},
+			{
+				ID:        "302",
+				AuthorID:  "400",
+				Author:    "fish#0001",
+				Timestamp: day.Add(48 * time.Hour),
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "Thronebutt leaderboard",
+						URL:         "https://thronebutt.com/weekly",
+						Description: "Top score: 1_000",
+						Image:       &discordgo.MessageEmbedImage{URL: "https://thronebutt.com/board.png"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// goldenIndex lists channels of two guilds, archived in different formats
+func goldenIndex() *ArchiveIndex {
+	idx := new(ArchiveIndex)
+	idx.update(goldenChannel(), FormatMarkdown)
+	idx.update(goldenChannel(), FormatHTML)
+	idx.update(&ChannelArchive{GuildID: "100", Guild: "Nuclear Throne", ChannelID: "201", Name: "art", Pins: make([]*Pin, 4)}, FormatHTML)
+	idx.update(&ChannelArchive{GuildID: "101", ChannelID: "210", Name: "general", Pins: make([]*Pin, 1)}, FormatMarkdown)
+	return idx
+}
+
+func TestRenderGolden(t *testing.T) {
+	for _, f := range ArchiveFormats {
+		t.Run(string(f), func(t *testing.T) {
+			b, err := f.render(goldenChannel())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "channel"+f.Ext()+".golden", b)
+
+			if b, err = f.renderIndex(goldenIndex()); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "index"+f.Ext()+".golden", b)
+		})
+	}
+}
+
+// checkGolden compares got to testdata/name, or writes it there with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	p := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create it", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run the tests with -update if the change is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// UnknownItemError is returned when a name can't be resolved to an item
+type UnknownItemError struct {
+	Kind       string
+	Name       string
+	Suggestion string
+}
+
+func (e *UnknownItemError) Error() string {
+	if e.Suggestion == "" {
+		return fmt.Sprintf("Invalid %s `%s`", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("Invalid %s `%s`. Did you mean `%s`?", e.Kind, e.Name, e.Suggestion)
+}
+
+// ItemResolver resolves user input to the canonical name of an item
+type ItemResolver struct {
+	Kind  string
+	Items *itemMap
+
+	// Prefixes are stripped from input before matching. Ex. `crown of`
+	Prefixes []string
+
+	lookup map[string]string
+}
+
+// Resolvers for each kind of game item, built from the loaded game data
+var (
+	CharResolver     *ItemResolver
+	WeaponResolver   *ItemResolver
+	CrownResolver    *ItemResolver
+	MutationResolver *ItemResolver
+	UltraResolver    *ItemResolver
+)
+
+// variantPrefixes map prefixes of weapon variants to how they're spelled in item names
+var variantPrefixes = map[string]string{
+	"golden": "golden",
+	"gold":   "golden",
+	"ultra":  "ultra",
+}
+
+// newResolver returns a resolver for the items. Names, display names and aliases of different items
+// which only differ in case or punctuation are ambiguous, so they're an error.
+func newResolver(kind string, items *itemMap, prefixes ...string) (*ItemResolver, error) {
+	r := &ItemResolver{
+		Kind:     kind,
+		Items:    items,
+		Prefixes: prefixes,
+		lookup:   make(map[string]string),
+	}
+
+	for _, it := range items.Items() {
+		for _, name := range append([]string{it.Name, it.Display}, it.Aliases...) {
+			key := normalize(name)
+			if other, ok := r.lookup[key]; ok && other != it.Name {
+				return nil, fmt.Errorf("gamedata: %s name %q of %q is also a name of %q", kind, name, it.Name, other)
+			}
+			r.lookup[key] = it.Name
+		}
+	}
+
+	return r, nil
+}
+
+// normalize lowercases s and removes everything but letters and digits,
+// so `Y.V.`, `big dog` and `bigdog` all compare equal
+func normalize(s string) string {
+	var buf strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// words lowercases s, turns punctuation into spaces and collapses whitespace
+func words(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// Resolve returns the canonical name of the item matching name.
+// If nothing matches, the error is an *UnknownItemError with the closest name as a suggestion.
+func (r *ItemResolver) Resolve(name string) (string, error) {
+	if res, ok := r.find(words(name)); ok {
+		return res, nil
+	}
+
+	return "", &UnknownItemError{
+		Kind:       r.Kind,
+		Name:       name,
+		Suggestion: r.suggest(name),
+	}
+}
+
+// ResolveID is like Resolve but returns the item's ID
+func (r *ItemResolver) ResolveID(name string) (int, error) {
+	res, err := r.Resolve(name)
+	if err != nil {
+		return -1, err
+	}
+	return r.Items.NameToID(res), nil
+}
+
+func (r *ItemResolver) find(w string) (string, bool) {
+	if res, ok := r.lookup[normalize(w)]; ok {
+		return res, true
+	}
+
+	for _, p := range r.Prefixes {
+		if strings.HasPrefix(w, p+" ") {
+			if res, ok := r.lookup[normalize(strings.TrimPrefix(w, p+" "))]; ok {
+				return res, true
+			}
+		}
+	}
+
+	// Golden and ultra weapons can be written as the variant prefix followed by any name of the base weapon
+	for p, variant := range variantPrefixes {
+		if !strings.HasPrefix(w, p+" ") {
+			continue
+		}
+
+		base, ok := r.find(strings.TrimPrefix(w, p+" "))
+		if !ok {
+			continue
+		}
+
+		if _, ok = r.Items.Get(variant + " " + base); ok {
+			return variant + " " + base, true
+		}
+	}
+
+	return "", false
+}
+
+// Complete returns the display names of up to 25 items whose name or display name contains the partially typed
+// value. Items starting with it come first.
+func (r *ItemResolver) Complete(value string) []string {
+	v := normalize(value)
+
+	var prefixed, contained []string
+	for _, it := range r.Items.Items() {
+		name, display := normalize(it.Name), normalize(it.Display)
+		switch {
+		case strings.HasPrefix(name, v) || strings.HasPrefix(display, v):
+			prefixed = append(prefixed, it.Display)
+		case strings.Contains(name, v) || strings.Contains(display, v):
+			contained = append(contained, it.Display)
+		}
+	}
+
+	res := append(prefixed, contained...)
+	if len(res) > 25 {
+		res = res[:25]
+	}
+	return res
+}
+
+// suggest returns the item name or alias closest to name, or an empty string if nothing is close enough
+func (r *ItemResolver) suggest(name string) string {
+	n := normalize(name)
+	if n == "" {
+		return ""
+	}
+
+	best, bestDist := "", -1
+	for key, res := range r.lookup {
+		d := levenshtein(n, key)
+		if bestDist == -1 || d < bestDist || (d == bestDist && res < best) {
+			best, bestDist = res, d
+		}
+	}
+
+	// Allow roughly one typo for every three characters
+	if limit := len(n)/3 + 1; bestDist > limit {
+		return ""
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
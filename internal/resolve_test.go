@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	for _, c := range []struct {
+		r    *ItemResolver
+		name string
+		want string
+		err  string
+	}{
+		{CrownResolver, "crown of death", "death", ""},
+		{CrownResolver, "Crown Of Death", "death", ""},
+		{CrownResolver, "death", "death", ""},
+		{CrownResolver, "crown of curse", "curses", ""},
+		{CrownResolver, "no crown", "none", ""},
+		{WeaponResolver, "GL", "grenade launcher", ""},
+		{WeaponResolver, "g.l.", "grenade launcher", ""},
+		{WeaponResolver, "super xbow", "super crossbow", ""},
+		{WeaponResolver, "Super-Crossbow", "super crossbow", ""},
+		{WeaponResolver, "chicken sword", "chicken sword", ""},
+		{WeaponResolver, "katana", "chicken sword", ""},
+		{CharResolver, "yv", "venuz", ""},
+		{CharResolver, "y.v.", "venuz", ""},
+		{CharResolver, "Y.V.", "venuz", ""},
+		{CharResolver, "bigdog", "bigdog", ""},
+		{CharResolver, "big dog", "bigdog", ""},
+		{UltraResolver, "ultra redemption", "redemption", ""},
+
+		// Golden and ultra variants take any name of the base weapon
+		{WeaponResolver, "golden gl", "golden grenade launcher", ""},
+		{WeaponResolver, "gold xbow", "golden crossbow", ""},
+		{WeaponResolver, "Golden Revolver", "golden revolver", ""},
+		{WeaponResolver, "ultra gl", "ultra grenade launcher", ""},
+		{WeaponResolver, "ultra shotty", "ultra shotgun", ""},
+		{WeaponResolver, "golden super xbow", "", "Invalid weapon `golden super xbow`. Did you mean `golden crossbow`?"},
+
+		// Typos get a suggestion if they're close enough
+		{WeaponResolver, "chiken sword", "", "Invalid weapon `chiken sword`. Did you mean `chicken sword`?"},
+		{WeaponResolver, "grenade launcer", "", "Invalid weapon `grenade launcer`. Did you mean `grenade launcher`?"},
+		{WeaponResolver, "super xbwo", "", "Invalid weapon `super xbwo`. Did you mean `super crossbow`?"},
+		{CrownResolver, "crown of deth", "", "Invalid crown `crown of deth`. Did you mean `death`?"},
+		{CharResolver, "venis", "", "Invalid character `venis`. Did you mean `venuz`?"},
+		{WeaponResolver, "qwerty", "", "Invalid weapon `qwerty`"},
+		{WeaponResolver, "", "", "Invalid weapon ``"},
+	} {
+		got, err := c.r.Resolve(c.name)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s %q: got %q, %v, want error %q", c.r.Kind, c.name, got, err, c.err)
+			}
+
+			if _, ok := err.(*UnknownItemError); !ok {
+				t.Errorf("%s %q: got %T, want *UnknownItemError", c.r.Kind, c.name, err)
+			}
+			continue
+		}
+
+		if err != nil || got != c.want {
+			t.Errorf("%s %q: got %q, %v, want %q", c.r.Kind, c.name, got, err, c.want)
+		}
+	}
+
+	if id, err := WeaponResolver.ResolveID("GL"); err != nil || id != Weapons.NameToID("grenade launcher") {
+		t.Errorf("got ID %d, %v, want %d", id, err, Weapons.NameToID("grenade launcher"))
+	}
+}
+
+func TestNewResolverAmbiguous(t *testing.T) {
+	items, err := newItemMap("weapon", []*Item{
+		{ID: 1, Name: "grenade launcher", Display: "Grenade Launcher", Aliases: []string{"gl", "GL"}},
+		{ID: 2, Name: "golden laser", Aliases: []string{"G.L."}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = newResolver("weapon", items); err == nil || !strings.Contains(err.Error(), `"G.L." of "golden laser" is also a name of "grenade launcher"`) {
+		t.Errorf("got %v, want an ambiguous name error", err)
+	}
+
+	// A game data file with ambiguous names is rejected and the loaded game data is kept
+	err = setGameData([]byte(`{
+		"version": 1,
+		"characters": [{"id": 1, "name": "fish"}],
+		"weapons": [{"id": 1, "name": "super crossbow"}, {"id": 2, "name": "super cross-bow"}]
+	}`))
+	if err == nil {
+		t.Error("loaded game data with ambiguous weapon names")
+	}
+
+	if name, err := WeaponResolver.Resolve("super xbow"); err != nil || name != "super crossbow" {
+		t.Errorf("got %q, %v after a failed load, want the old game data", name, err)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"chikensword", "chickensword", 1},
+		{"xbwo", "xbow", 2},
+	} {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -15,6 +15,14 @@ type Context struct {
 	Ses   *discordgo.Session
 
 	Args Args
+	// Values are the parsed arguments of routes with typed arguments
+	Values Values
+	// Prefix is the prefix the command was called with. Ex. `thronebot` or `/` for slash commands.
+	Prefix string
+
+	// Interaction is the slash command the context was created for, nil for text commands.
+	// Replies to slash commands are sent as the interaction's response.
+	Interaction *Interaction
 
 	Vars *sync.Map
 }
@@ -27,22 +35,27 @@ func (c *Context) Get(key string) (interface{}, bool) { return c.Vars.Load(key)
 
 // Reply sends a normal message to the channel the parent message was sent in
 func (c *Context) Reply(args ...interface{}) {
+	if c.Interaction != nil {
+		c.Interaction.reply(c.Ses, &interactionMessage{Content: fmt.Sprint(args...)})
+		return
+	}
 	c.Ses.ChannelMessageSend(c.Msg.ChannelID, fmt.Sprint(args...))
 }
 
 // ReplyEmbed same as Reply but sends and Embed
 func (c *Context) ReplyEmbed(e *discordgo.MessageEmbed) {
+	if c.Interaction != nil {
+		c.Interaction.reply(c.Ses, &interactionMessage{Embeds: []*discordgo.MessageEmbed{e}})
+		return
+	}
 	c.Ses.ChannelMessageSendEmbed(c.Msg.ChannelID, e)
 }
 
 // ReplyEmbedQuick same as ReplyEmbed but has only the Description property
 func (c *Context) ReplyEmbedQuick(args ...interface{}) {
-	c.Ses.ChannelMessageSendEmbed(
-		c.Msg.ChannelID,
-		&discordgo.MessageEmbed{
-			Description: fmt.Sprint(args...),
-		},
-	)
+	c.ReplyEmbed(&discordgo.MessageEmbed{
+		Description: fmt.Sprint(args...),
+	})
 }
 
 // Guild retrieves a guild from the state or restapi
@@ -63,6 +76,15 @@ func (c *Context) Channel(channelID string) (*discordgo.Channel, error) {
 	return ch, err
 }
 
+// GuildID returns the ID of the guild the message was sent in, or an empty string for direct messages
+func (c *Context) GuildID() string {
+	ch, err := c.Channel(c.Msg.ChannelID)
+	if err != nil {
+		return ""
+	}
+	return ch.GuildID
+}
+
 // Member retrieves a member from the state or restapi
 func (c *Context) Member(guildID, userID string) (*discordgo.Member, error) {
 	m, err := c.Ses.State.Member(guildID, userID)
@@ -0,0 +1,127 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/necroforger/dgrouter"
+)
+
+// HelpHandler returns a handler which prints help for the routes below r.
+// `help` lists every command the author may use and `help weekly ban` describes a single command.
+// Routes the author lacks the permission for are hidden.
+// The commands are shown with the guild's preferred prefix from prefixes.
+func (r *Route) HelpHandler(prefixes PrefixResolver) HandlerFunc {
+	return func(ctx *Context) {
+		prefix := preferred(prefixes, ctx.GuildID(), "@"+ctx.Ses.State.User.Username)
+		var path []string
+		if len(ctx.Args) > 1 {
+			path = ctx.Args[1:]
+		}
+
+		checks := permissionCache{}
+		if len(path) == 0 {
+			ctx.ReplyEmbed(&discordgo.MessageEmbed{
+				Title:       "Commands",
+				Description: r.commandList(ctx, checks, prefix),
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: "Use `" + withPrefix(prefix, "help <command>") + "` for more information on a command.",
+				},
+			})
+			return
+		}
+
+		rt, depth := r.FindFull(path...)
+		if depth != len(path) || rt == r.Route || !checks.allowed(ctx, rt) {
+			ctx.Reply("No command named `", strings.Join(path, " "), "`. Try `", withPrefix(prefix, "help"), "`.")
+			return
+		}
+
+		ctx.ReplyEmbed((&Route{rt}).helpEmbed(ctx, checks, prefix))
+	}
+}
+
+// fullName returns the names of the route and its parents, excluding the root
+func fullName(rt *dgrouter.Route) string {
+	var names []string
+	for ; rt != nil && rt.Parent != nil; rt = rt.Parent {
+		names = append([]string{rt.Name}, names...)
+	}
+	return strings.Join(names, " ")
+}
+
+func (r *Route) commandList(ctx *Context, checks permissionCache, prefix string) string {
+	var buf strings.Builder
+
+	var walk func(rt *dgrouter.Route)
+	walk = func(rt *dgrouter.Route) {
+		for _, child := range rt.Routes {
+			if !checks.allowed(ctx, child) {
+				continue
+			}
+
+			if child.Handler != nil {
+				buf.WriteString("`" + withPrefix(prefix, fullName(child)) + "`")
+				if child.Description != "" {
+					buf.WriteString(" - " + child.Description)
+				}
+				buf.WriteString("\n")
+			}
+			walk(child)
+		}
+	}
+	walk(r.Route)
+
+	return buf.String()
+}
+
+func (r *Route) helpEmbed(ctx *Context, checks permissionCache, prefix string) *discordgo.MessageEmbed {
+	i := getInfo(r.Route)
+	name := fullName(r.Route)
+
+	e := &discordgo.MessageEmbed{
+		Title:       withPrefix(prefix, name),
+		Description: r.Description,
+	}
+
+	e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "Usage", Value: "`" + usage(r.Route, prefix) + "`"})
+
+	var args []string
+	for _, a := range i.args {
+		if a.Desc != "" {
+			args = append(args, "`"+a.Name+"` - "+a.Desc)
+		}
+	}
+
+	if len(args) > 0 {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "Arguments", Value: strings.Join(args, "\n")})
+	}
+
+	if len(r.Aliases) > 0 {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "Aliases", Value: strings.Join(r.Aliases, ", ")})
+	}
+
+	var perms []string
+	for rt := r.Route; rt != nil; rt = rt.Parent {
+		if p := getInfo(rt).permission; p != nil {
+			perms = append(perms, p.Name)
+		}
+	}
+
+	if len(perms) > 0 {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "Requires", Value: strings.Join(perms, ", ")})
+	}
+
+	var subs []string
+	for _, child := range r.Routes {
+		if checks.allowed(ctx, child) {
+			subs = append(subs, child.Name)
+		}
+	}
+
+	if len(subs) > 0 {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "Subcommands", Value: strings.Join(subs, ", ")})
+	}
+
+	return e
+}
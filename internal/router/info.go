@@ -0,0 +1,106 @@
+package router
+
+import (
+	"sync"
+
+	"github.com/necroforger/dgrouter"
+)
+
+// Permission describes who is allowed to see and run a route
+type Permission struct {
+	// Name is shown in help. Ex. `staff`
+	Name string
+
+	// Check reports whether the author of ctx has the permission
+	Check func(*Context) bool
+
+	// Deny is called instead of the handler when the check fails. Optional.
+	Deny func(*Context)
+}
+
+// Middleware returns a MiddlewareFunc which only runs the handler if the permission check passes
+func (p *Permission) Middleware() MiddlewareFunc {
+	return func(fn HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if p.Check(ctx) {
+				fn(ctx)
+			} else if p.Deny != nil {
+				p.Deny(ctx)
+			}
+		}
+	}
+}
+
+// info is the metadata of a route which dgrouter has no place for
+type info struct {
+	usage      string
+	permission *Permission
+
+	// childPermission is given to routes added after Require was called
+	childPermission *Permission
+
+	// options are the options of the route's slash command, if hasOptions is set
+	options    []*Option
+	hasOptions bool
+	// optionSep joins the option values into the route's arguments
+	optionSep string
+
+	// args are the typed arguments of the route, if hasArgs is set
+	args    []*Arg
+	hasArgs bool
+}
+
+var (
+	infoMu sync.RWMutex
+	infos  = make(map[*dgrouter.Route]*info)
+)
+
+func getInfo(r *dgrouter.Route) *info {
+	infoMu.RLock()
+	defer infoMu.RUnlock()
+
+	if i, ok := infos[r]; ok {
+		return i
+	}
+	return &info{}
+}
+
+func updateInfo(r *dgrouter.Route, fn func(i *info)) {
+	infoMu.Lock()
+	defer infoMu.Unlock()
+
+	i, ok := infos[r]
+	if !ok {
+		i = &info{}
+		infos[r] = i
+	}
+	fn(i)
+}
+
+// Allowed reports whether the author of ctx may use the route, taking the permissions of parent routes into account
+func (r *Route) Allowed(ctx *Context) bool {
+	return permissionCache{}.allowed(ctx, r.Route)
+}
+
+// permissionCache holds the results of the permission checks done for one command,
+// so walking many routes checks each permission once
+type permissionCache map[*Permission]bool
+
+func (c permissionCache) allowed(ctx *Context, rt *dgrouter.Route) bool {
+	for ; rt != nil; rt = rt.Parent {
+		p := getInfo(rt).permission
+		if p == nil {
+			continue
+		}
+
+		ok, checked := c[p]
+		if !checked {
+			ok = p.Check(ctx)
+			c[p] = ok
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,453 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/necroforger/dgrouter"
+)
+
+// interactionsAPI is the version of the REST API application commands are available on.
+// The discordgo version we use predates them, so requests are made by hand.
+const interactionsAPI = "https://discord.com/api/v10/"
+
+// defaultSubcommand is the name of the subcommand which runs a route that also has subcommands,
+// since Discord can't run a command with subcommands itself
+const defaultSubcommand = "show"
+
+// OptionType is the type of a slash command option
+type OptionType int
+
+// Option types, as numbered by Discord
+const (
+	OptionString  OptionType = 3
+	OptionInteger OptionType = 4
+	OptionBoolean OptionType = 5
+	OptionUser    OptionType = 6
+	OptionChannel OptionType = 7
+	OptionRole    OptionType = 8
+)
+
+// Option is an option of a route's slash command. The options of a slash command are turned into the text
+// arguments of the route in the order they were declared in, so handlers work the same for both.
+type Option struct {
+	Name string
+	Desc string
+	Type OptionType
+
+	Required bool
+	// Choices are the only values the option accepts, if any
+	Choices []string
+	// Prefix is put in front of the value in the text arguments. Ex. `|` before the reason of a ban.
+	Prefix string
+	// Complete returns up to 25 suggestions for the partially typed value. The values of the other options
+	// are passed by name.
+	Complete func(value string, opts map[string]string) []string
+}
+
+// Options sets the options of the route's slash command. Routes without options or typed arguments take
+// their arguments as a single optional `args` option. Boolean options are flags: their name is added to the arguments when true.
+func (r *Route) Options(opts ...*Option) *Route {
+	updateInfo(r.Route, func(i *info) {
+		i.options = opts
+		i.hasOptions = true
+	})
+	return r
+}
+
+// JoinOptions sets the separator the option values of the route's slash command are joined with.
+// Options that aren't given are left empty, instead of left out, if it isn't a space.
+func (r *Route) JoinOptions(sep string) *Route {
+	updateInfo(r.Route, func(i *info) { i.optionSep = sep })
+	return r
+}
+
+// options returns the declared options of the route, the options of its typed arguments, or the catch-all option
+func options(rt *dgrouter.Route) []*Option {
+	i := getInfo(rt)
+	if i.hasOptions {
+		return i.options
+	}
+
+	if i.hasArgs {
+		res := make([]*Option, len(i.args))
+		for k, a := range i.args {
+			res[k] = a.option()
+		}
+		return res
+	}
+	return []*Option{{Name: "args", Desc: "Arguments of the command", Type: OptionString}}
+}
+
+type applicationCommand struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Options     []*commandOption `json:"options,omitempty"`
+}
+
+type commandOption struct {
+	Type         int              `json:"type"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Required     bool             `json:"required,omitempty"`
+	Choices      []*optionChoice  `json:"choices,omitempty"`
+	Autocomplete bool             `json:"autocomplete,omitempty"`
+	Options      []*commandOption `json:"options,omitempty"`
+}
+
+type optionChoice struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Discord's subcommand option types
+const (
+	optionSubcommand      = 1
+	optionSubcommandGroup = 2
+)
+
+// commandDesc returns the description of the route, cut to the 100 characters Discord allows
+func commandDesc(rt *dgrouter.Route) string {
+	d := []rune(rt.Description)
+	if len(d) > 100 {
+		return string(d[:99]) + "…"
+	}
+	return string(d)
+}
+
+// described returns the subroutes of rt which are slash commands: those with a description
+// that can be run or have subcommands of their own
+func described(rt *dgrouter.Route) []*dgrouter.Route {
+	var res []*dgrouter.Route
+	for _, child := range rt.Routes {
+		if child.Description != "" && (child.Handler != nil || len(described(child)) > 0) {
+			res = append(res, child)
+		}
+	}
+	return res
+}
+
+// commandOptions converts the options of the route for Discord. Required options must come first.
+func commandOptions(rt *dgrouter.Route) []*commandOption {
+	var res []*commandOption
+	for _, o := range options(rt) {
+		co := &commandOption{
+			Type:         int(o.Type),
+			Name:         o.Name,
+			Description:  o.Desc,
+			Required:     o.Required,
+			Autocomplete: o.Complete != nil,
+		}
+
+		for _, c := range o.Choices {
+			co.Choices = append(co.Choices, &optionChoice{Name: c, Value: c})
+		}
+		res = append(res, co)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Required && !res[j].Required })
+	return res
+}
+
+// subcommands converts the subroutes of rt to subcommands. Discord allows one level of subcommand groups,
+// deeper routes are left out.
+func subcommands(rt *dgrouter.Route, group bool) []*commandOption {
+	var res []*commandOption
+	if rt.Handler != nil {
+		res = append(res, &commandOption{
+			Type:        optionSubcommand,
+			Name:        defaultSubcommand,
+			Description: commandDesc(rt),
+			Options:     commandOptions(rt),
+		})
+	}
+
+	for _, child := range described(rt) {
+		if children := described(child); len(children) > 0 && !group {
+			res = append(res, &commandOption{
+				Type:        optionSubcommandGroup,
+				Name:        child.Name,
+				Description: commandDesc(child),
+				Options:     subcommands(child, true),
+			})
+			continue
+		}
+
+		if child.Handler == nil {
+			continue
+		}
+
+		res = append(res, &commandOption{
+			Type:        optionSubcommand,
+			Name:        child.Name,
+			Description: commandDesc(child),
+			Options:     commandOptions(child),
+		})
+	}
+	return res
+}
+
+// applicationCommands returns a slash command for every top level route with a description
+func (r *Route) applicationCommands() []*applicationCommand {
+	var res []*applicationCommand
+	for _, rt := range described(r.Route) {
+		cmd := &applicationCommand{Name: rt.Name, Description: commandDesc(rt)}
+		if len(described(rt)) > 0 {
+			cmd.Options = subcommands(rt, false)
+		} else {
+			cmd.Options = commandOptions(rt)
+		}
+		res = append(res, cmd)
+	}
+	return res
+}
+
+// RegisterCommands registers the routes as the application's slash commands, replacing the old ones
+func (r *Route) RegisterCommands(s *discordgo.Session, appID string) error {
+	endpoint := "applications/" + appID + "/commands"
+	_, err := s.RequestWithBucketID(http.MethodPut, interactionsAPI+endpoint, r.applicationCommands(), endpoint)
+	return err
+}
+
+// Interaction types, as numbered by Discord
+const (
+	interactionCommand      = 2
+	interactionAutocomplete = 4
+)
+
+// Interaction callback types, as numbered by Discord
+const (
+	callbackDeferredMessage = 5
+	callbackAutocomplete    = 8
+)
+
+// Interaction is a slash command invocation
+type Interaction struct {
+	ID            string            `json:"id"`
+	ApplicationID string            `json:"application_id"`
+	Type          int               `json:"type"`
+	Data          *InteractionData  `json:"data"`
+	GuildID       string            `json:"guild_id"`
+	ChannelID     string            `json:"channel_id"`
+	Member        *discordgo.Member `json:"member"`
+	User          *discordgo.User   `json:"user"`
+	Token         string            `json:"token"`
+
+	mu      sync.Mutex
+	replied bool
+}
+
+// InteractionData is the command an interaction invokes
+type InteractionData struct {
+	Name    string               `json:"name"`
+	Options []*InteractionOption `json:"options"`
+}
+
+// InteractionOption is the value of an option, or a subcommand and its options
+type InteractionOption struct {
+	Name    string               `json:"name"`
+	Type    int                  `json:"type"`
+	Value   json.RawMessage      `json:"value"`
+	Focused bool                 `json:"focused"`
+	Options []*InteractionOption `json:"options"`
+}
+
+// text returns the value of the option as it would be typed
+func (o *InteractionOption) text() string {
+	var s string
+	if json.Unmarshal(o.Value, &s) == nil {
+		return s
+	}
+	return string(o.Value)
+}
+
+// author returns who invoked the interaction
+func (in *Interaction) author() *discordgo.User {
+	if in.Member != nil && in.Member.User != nil {
+		return in.Member.User
+	}
+	return in.User
+}
+
+// command returns the route path of the invoked command, its option values by name and the focused option
+func (in *Interaction) command() (path []string, opts map[string]string, focused string) {
+	path = []string{in.Data.Name}
+	list := in.Data.Options
+	for len(list) > 0 && (list[0].Type == optionSubcommand || list[0].Type == optionSubcommandGroup) {
+		path = append(path, list[0].Name)
+		list = list[0].Options
+	}
+
+	opts = make(map[string]string)
+	for _, o := range list {
+		opts[o.Name] = o.text()
+		if o.Focused {
+			focused = o.Name
+		}
+	}
+	return path, opts, focused
+}
+
+// callback responds to the interaction
+func (in *Interaction) callback(s *discordgo.Session, typ int, data interface{}) error {
+	body := map[string]interface{}{"type": typ}
+	if data != nil {
+		body["data"] = data
+	}
+
+	endpoint := "interactions/" + in.ID + "/" + in.Token + "/callback"
+	_, err := s.RequestWithBucketID(http.MethodPost, interactionsAPI+endpoint, body, "interactions/"+in.ID)
+	return err
+}
+
+type interactionMessage struct {
+	Content string                    `json:"content,omitempty"`
+	Embeds  []*discordgo.MessageEmbed `json:"embeds,omitempty"`
+}
+
+// reply sends a message in response to the interaction. The first reply replaces the deferred response,
+// later ones are sent as followups.
+func (in *Interaction) reply(s *discordgo.Session, msg *interactionMessage) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	endpoint := "webhooks/" + in.ApplicationID + "/" + in.Token
+	if !in.replied {
+		in.replied = true
+		_, err := s.RequestWithBucketID(http.MethodPatch, interactionsAPI+endpoint+"/messages/@original", msg, endpoint)
+		return err
+	}
+
+	_, err := s.RequestWithBucketID(http.MethodPost, interactionsAPI+endpoint, msg, endpoint)
+	return err
+}
+
+// finish removes the deferred response if the handler never replied, ex. because permission was denied
+func (in *Interaction) finish(s *discordgo.Session) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.replied {
+		return nil
+	}
+
+	endpoint := "webhooks/" + in.ApplicationID + "/" + in.Token
+	_, err := s.RequestWithBucketID(http.MethodDelete, interactionsAPI+endpoint+"/messages/@original", nil, endpoint)
+	return err
+}
+
+// find returns the route of the command path. The default subcommand runs its parent.
+func (r *Route) find(path []string) (*dgrouter.Route, error) {
+	rt, depth := r.FindFull(path...)
+	if depth != len(path) && path[len(path)-1] == defaultSubcommand {
+		path = path[:len(path)-1]
+		rt, depth = r.FindFull(path...)
+	}
+
+	if depth != len(path) || rt.Handler == nil {
+		return nil, errRouteNotFound
+	}
+	return rt, nil
+}
+
+// args converts the option values of an interaction to the text arguments of the route
+func args(rt *dgrouter.Route, path []string, opts map[string]string) Args {
+	sep := getInfo(rt).optionSep
+	if sep == "" {
+		sep = string(separator)
+	}
+
+	var values []string
+	for _, o := range options(rt) {
+		v, ok := opts[o.Name]
+		if o.Type == OptionBoolean {
+			v, ok = o.Name, ok && v == "true"
+		}
+
+		if !ok {
+			if sep != string(separator) {
+				values = append(values, "")
+			}
+			continue
+		}
+
+		if o.Prefix != "" {
+			v = o.Prefix + string(separator) + v
+		}
+		values = append(values, v)
+	}
+
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+
+	res := Args{strings.Join(path, string(separator))}
+	if len(values) > 0 {
+		res = append(res, ParseArgs(strings.Join(values, sep))...)
+	}
+	return res
+}
+
+// HandleInteraction runs the route of a slash command, or answers an autocomplete request for one of its options.
+// data is the payload of an INTERACTION_CREATE gateway event.
+func (r *Route) HandleInteraction(s *discordgo.Session, data json.RawMessage) error {
+	in := new(Interaction)
+	if err := json.Unmarshal(data, in); err != nil {
+		return err
+	}
+
+	if in.Data == nil {
+		return errors.New("router: interaction has no command")
+	}
+
+	path, opts, focused := in.command()
+	rt, err := r.find(path)
+	if err != nil {
+		return err
+	}
+
+	switch in.Type {
+	case interactionAutocomplete:
+		var choices []*optionChoice
+		for _, o := range options(rt) {
+			if o.Name != focused || o.Complete == nil {
+				continue
+			}
+
+			for _, c := range o.Complete(opts[o.Name], opts) {
+				if len(choices) == 25 {
+					break
+				}
+				choices = append(choices, &optionChoice{Name: c, Value: c})
+			}
+		}
+
+		return in.callback(s, callbackAutocomplete, map[string]interface{}{"choices": choices})
+	case interactionCommand:
+		// Handlers may take longer than the 3 seconds Discord waits for a response
+		if err = in.callback(s, callbackDeferredMessage, nil); err != nil {
+			return err
+		}
+
+		a := args(rt, path, opts)
+		m := &discordgo.Message{
+			ID:        in.ID,
+			ChannelID: in.ChannelID,
+			GuildID:   in.GuildID,
+			Author:    in.author(),
+			Content:   "/" + strings.Join(a, string(separator)),
+		}
+
+		ctx := NewContext(s, m, a, rt)
+		ctx.Interaction = in
+		ctx.Prefix = "/"
+		rt.Handler(ctx)
+		return in.finish(s)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCommands returns a route tree with every kind of slash command. Handlers record the context they ran with in ran.
+func testCommands(ran *[]*Context) *Route {
+	h := func(ctx *Context) { *ran = append(*ran, ctx) }
+	complete := func(value string, _ map[string]string) []string {
+		var res []string
+		for i := 0; i < 30; i++ {
+			res = append(res, fmt.Sprint(value, i))
+		}
+		return res
+	}
+
+	r := NewRoute()
+	r.On("ping", h).Desc("Check the bot is alive.")
+	r.On("hidden", h)
+
+	weekly := r.On("weekly", h).Desc("Show the weekly.")
+	weekly.On("ban", h).Desc("Ban an item from the weekly.").Args(
+		&Arg{Name: "action", Desc: "Ban or unban", Kind: ArgEnum, Required: true, Choices: []string{"add", "del"}},
+		&Arg{Name: "name", Desc: "The item", Kind: ArgItem, Required: true, Complete: complete},
+		&Arg{Name: "duration", Desc: "How long", Kind: ArgDuration},
+		&Arg{Name: "reason", Desc: "Why", Kind: ArgRest, Prefix: "|"},
+	)
+	weekly.On("history", h).Desc(strings.Repeat("a", 120)).Args(
+		&Arg{Name: "n", Desc: "How many", Kind: ArgInt},
+		&Arg{Name: "global", Desc: "Every guild", Kind: ArgFlag},
+	)
+	weekly.On("suggest", h).Desc("Suggest a build.").Options(
+		&Option{Name: "char", Desc: "Character", Type: OptionString, Required: true},
+		&Option{Name: "skin", Desc: "Skin", Type: OptionString},
+		&Option{Name: "weap", Desc: "Weapon", Type: OptionString},
+		&Option{Name: "crown", Desc: "Crown", Type: OptionString},
+	).JoinOptions("/")
+
+	config := r.On("config", nil).Desc("Change the config.")
+	config.On("list", h).Desc("List the settings.")
+	guild := config.On("guild", nil).Desc("Guild settings.")
+	guild.On("get", h).Desc("Get a setting.").Options(
+		&Option{Name: "guild", Desc: "Guild", Type: OptionString},
+		&Option{Name: "name", Desc: "Setting", Type: OptionString, Required: true},
+	)
+	guild.On("nested", nil).Desc("Too deep.").On("deeper", h).Desc("Left out.")
+	guild.On("undescribed", h)
+	return r
+}
+
+// outline lists the options of the commands as `path: option...`. Required options end in `*`,
+// autocompleted ones in `~`, and options of other types than string have their type after a colon.
+func outline(cmds []*applicationCommand) []string {
+	var res []string
+	var walk func(path string, opts []*commandOption)
+	walk = func(path string, opts []*commandOption) {
+		var line []string
+		for _, o := range opts {
+			if o.Type == optionSubcommand || o.Type == optionSubcommandGroup {
+				walk(path+" "+o.Name, o.Options)
+				continue
+			}
+
+			s := o.Name
+			if o.Type != int(OptionString) {
+				s += fmt.Sprint(":", o.Type)
+			}
+			for _, c := range o.Choices {
+				s += "|" + c.Name
+			}
+			if o.Required {
+				s += "*"
+			}
+			if o.Autocomplete {
+				s += "~"
+			}
+			line = append(line, s)
+		}
+
+		if len(opts) == 0 || len(line) > 0 {
+			res = append(res, strings.TrimSpace(path+": "+strings.Join(line, " ")))
+		}
+	}
+
+	for _, c := range cmds {
+		walk(c.Name, c.Options)
+	}
+	return res
+}
+
+func TestApplicationCommands(t *testing.T) {
+	var ran []*Context
+	cmds := testCommands(&ran).applicationCommands()
+
+	want := []string{
+		"ping: args",
+		"weekly show: args",
+		"weekly ban: action|add|del* name*~ duration reason",
+		"weekly history: n:4 global:5",
+		"weekly suggest: char* skin weap crown",
+		"config list: args",
+		"config guild get: name* guild",
+	}
+	if got := outline(cmds); !reflect.DeepEqual(got, want) {
+		t.Errorf("got commands\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	weekly := cmds[1]
+	if show := weekly.Options[0]; show.Name != defaultSubcommand || show.Description != "Show the weekly." {
+		t.Errorf("got default subcommand %q: %q, want %q with the description of weekly", show.Name, show.Description, defaultSubcommand)
+	}
+
+	if d := []rune(weekly.Options[2].Description); len(d) != 100 || d[99] != '…' {
+		t.Errorf("got a description of %d characters, want it cut to 100", len(d))
+	}
+
+	if guild := cmds[2].Options[1]; guild.Type != optionSubcommandGroup || len(guild.Options) != 1 {
+		t.Errorf("got guild %+v, want a group with only the get subcommand", guild)
+	}
+}
+
+func TestFind(t *testing.T) {
+	var ran []*Context
+	r := testCommands(&ran)
+
+	for _, c := range []struct {
+		path []string
+		want string
+	}{
+		{[]string{"ping"}, "ping"},
+		{[]string{"weekly"}, "weekly"},
+		{[]string{"weekly", "show"}, "weekly"},
+		{[]string{"weekly", "ban"}, "weekly ban"},
+		{[]string{"config", "guild", "get"}, "config guild get"},
+		{[]string{"config"}, ""},
+		{[]string{"config", "show"}, ""},
+		{[]string{"weekly", "nope"}, ""},
+		{[]string{"nope"}, ""},
+	} {
+		rt, err := r.find(c.path)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%q: found %q, want no route", c.path, fullName(rt))
+			}
+			continue
+		}
+
+		if err != nil || fullName(rt) != c.want {
+			t.Errorf("%q: got %v, want %q", c.path, err, c.want)
+		}
+	}
+}
+
+func TestInteractionArgs(t *testing.T) {
+	var ran []*Context
+	r := testCommands(&ran)
+
+	for _, c := range []struct {
+		path []string
+		opts map[string]string
+		want Args
+	}{
+		{[]string{"ping"}, nil, Args{"ping"}},
+		{[]string{"ping"}, map[string]string{"args": "a b"}, Args{"ping", "a", "b"}},
+		{[]string{"weekly", "show"}, nil, Args{"weekly show"}},
+		{
+			[]string{"weekly", "ban"},
+			map[string]string{"action": "add", "name": "crown of death", "reason": "too easy"},
+			Args{"weekly ban", "add", "crown", "of", "death", "|", "too", "easy"},
+		},
+		{[]string{"weekly", "ban"}, map[string]string{"action": "del", "duration": "2w", "name": "gl"}, Args{"weekly ban", "del", "gl", "2w"}},
+		{[]string{"config", "guild", "get"}, map[string]string{"name": "prefix"}, Args{"config guild get", "prefix"}},
+		{[]string{"weekly", "history"}, map[string]string{"n": "5", "global": "true"}, Args{"weekly history", "5", "global"}},
+		{[]string{"weekly", "history"}, map[string]string{"global": "false"}, Args{"weekly history"}},
+		{[]string{"weekly", "history"}, map[string]string{"global": "true"}, Args{"weekly history", "global"}},
+		{
+			[]string{"weekly", "suggest"},
+			map[string]string{"char": "fish", "skin": "b", "weap": "gl", "crown": "death"},
+			Args{"weekly suggest", "fish/b/gl/death"},
+		},
+		{[]string{"weekly", "suggest"}, map[string]string{"char": "fish", "weap": "gl", "crown": "death"}, Args{"weekly suggest", "fish//gl/death"}},
+		{[]string{"weekly", "suggest"}, map[string]string{"char": "fish", "crown": "crown of death"}, Args{"weekly suggest", "fish///crown", "of", "death"}},
+		{[]string{"weekly", "suggest"}, map[string]string{"char": "fish"}, Args{"weekly suggest", "fish"}},
+	} {
+		rt, err := r.find(c.path)
+		if err != nil {
+			t.Fatal(c.path, err)
+		}
+
+		if got := args(rt, c.path, c.opts); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q %v: got %q, want %q", c.path, c.opts, got, c.want)
+		}
+	}
+}
+
+// interaction returns an INTERACTION_CREATE payload invoking the command path with the options
+func interaction(typ int, path []string, opts ...map[string]interface{}) json.RawMessage {
+	list := make([]interface{}, len(opts))
+	for i, o := range opts {
+		list[i] = o
+	}
+
+	for i := len(path) - 1; i > 0; i-- {
+		list = []interface{}{map[string]interface{}{"name": path[i], "type": optionSubcommand, "options": list}}
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"id":             "i1",
+		"application_id": "app",
+		"type":           typ,
+		"token":          "tok",
+		"guild_id":       "g1",
+		"channel_id":     "c1",
+		"member":         map[string]interface{}{"user": map[string]interface{}{"id": "u1", "username": "fish"}},
+		"data":           map[string]interface{}{"name": path[0], "options": list},
+	})
+	return b
+}
+
+func opt(name string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"name": name, "type": int(OptionString), "value": value}
+}
+
+func TestHandleInteraction(t *testing.T) {
+	var ran []*Context
+	r := testCommands(&ran)
+	ses, rec := newTestSession(t)
+
+	err := r.HandleInteraction(ses, interaction(interactionCommand, []string{"weekly", "ban"},
+		opt("action", "add"), opt("name", "crown of death"), opt("reason", "too easy")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ran) != 1 {
+		t.Fatalf("ran %d handlers, want 1", len(ran))
+	}
+
+	ctx := ran[0]
+	want := Values{"action": "add", "name": "crown of death", "reason": "too easy"}
+	if !reflect.DeepEqual(ctx.Values, want) || ctx.Prefix != "/" || ctx.Msg.Author.ID != "u1" || ctx.Msg.ChannelID != "c1" || ctx.Interaction == nil {
+		t.Errorf("got values %v, prefix %q, message %+v, want %v", ctx.Values, ctx.Prefix, ctx.Msg, want)
+	}
+
+	// The handler didn't reply, so the deferred response is removed
+	sent := rec.requests()
+	if len(sent) != 2 ||
+		sent[0].Method != "POST" || sent[0].Path != "/api/v10/interactions/i1/tok/callback" || sent[0].Body["type"] != float64(callbackDeferredMessage) ||
+		sent[1].Method != "DELETE" || sent[1].Path != "/api/v10/webhooks/app/tok/messages/@original" {
+		t.Errorf("got requests %+v, want a deferred response which is deleted", sent)
+	}
+
+	// Replies edit the deferred response, then follow up
+	r.On("echo", func(ctx *Context) {
+		ctx.Reply("one")
+		ctx.Reply("two")
+	}).Desc("Echo.")
+
+	before := len(rec.requests())
+	if err = r.HandleInteraction(ses, interaction(interactionCommand, []string{"echo"})); err != nil {
+		t.Fatal(err)
+	}
+
+	sent = rec.requests()[before:]
+	if len(sent) != 3 ||
+		sent[1].Method != "PATCH" || sent[1].Path != "/api/v10/webhooks/app/tok/messages/@original" || sent[1].Body["content"] != "one" ||
+		sent[2].Method != "POST" || sent[2].Path != "/api/v10/webhooks/app/tok" || sent[2].Body["content"] != "two" {
+		t.Errorf("got requests %+v, want the deferred response edited, then a followup", sent)
+	}
+
+	// Invalid arguments are answered with the usage
+	ran = nil
+	before = len(rec.requests())
+	if err = r.HandleInteraction(ses, interaction(interactionCommand, []string{"weekly", "history"}, opt("n", "five"))); err != nil {
+		t.Fatal(err)
+	}
+
+	sent = rec.requests()[before:]
+	if len(ran) != 0 || len(sent) != 2 || sent[1].Body["content"] != "`n` must be a whole number\nUsage: `/weekly history [n] [global]`" {
+		t.Errorf("ran %d handlers, got requests %+v, want the usage", len(ran), sent)
+	}
+
+	// The default subcommand runs its parent
+	ran = nil
+	if err = r.HandleInteraction(ses, interaction(interactionCommand, []string{"weekly", "show"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0].Route.Name != "weekly" {
+		t.Errorf("ran %d handlers, want weekly", len(ran))
+	}
+
+	if err = r.HandleInteraction(ses, interaction(interactionCommand, []string{"config"})); err != errRouteNotFound {
+		t.Errorf("got %v for a command without a handler, want %v", err, errRouteNotFound)
+	}
+}
+
+func TestHandleAutocomplete(t *testing.T) {
+	var ran []*Context
+	r := testCommands(&ran)
+	ses, rec := newTestSession(t)
+
+	focused := opt("name", "cro")
+	focused["focused"] = true
+
+	err := r.HandleInteraction(ses, interaction(interactionAutocomplete, []string{"weekly", "ban"}, opt("action", "add"), focused))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ran) != 0 {
+		t.Errorf("ran %d handlers for an autocomplete request", len(ran))
+	}
+
+	sent := rec.requests()
+	if len(sent) != 1 || sent[0].Path != "/api/v10/interactions/i1/tok/callback" || sent[0].Body["type"] != float64(callbackAutocomplete) {
+		t.Fatalf("got requests %+v, want an autocomplete callback", sent)
+	}
+
+	choices := sent[0].Body["data"].(map[string]interface{})["choices"].([]interface{})
+	if len(choices) != 25 {
+		t.Errorf("got %d choices, want 25", len(choices))
+	}
+
+	if c := choices[0].(map[string]interface{}); c["name"] != "cro0" || c["value"] != "cro0" {
+		t.Errorf("got choice %v, want cro0", c)
+	}
+
+	// Options without completion get no choices
+	before := len(rec.requests())
+	focused = opt("reason", "too")
+	focused["focused"] = true
+	if err = r.HandleInteraction(ses, interaction(interactionAutocomplete, []string{"weekly", "ban"}, focused)); err != nil {
+		t.Fatal(err)
+	}
+
+	sent = rec.requests()[before:]
+	if len(sent) != 1 || sent[0].Body["data"].(map[string]interface{})["choices"] != nil {
+		t.Errorf("got requests %+v, want no choices", sent)
+	}
+}
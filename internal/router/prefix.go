@@ -0,0 +1,64 @@
+package router
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PrefixResolver returns the prefixes commands may start with in a guild, the preferred one first.
+// guildID is empty for direct messages. Mentions of the bot are always accepted as well.
+type PrefixResolver interface {
+	Prefixes(guildID string) []string
+}
+
+// PrefixFunc adapts a function to a PrefixResolver
+type PrefixFunc func(guildID string) []string
+
+// Prefixes calls f
+func (f PrefixFunc) Prefixes(guildID string) []string {
+	return f(guildID)
+}
+
+// StaticPrefixes is a PrefixResolver with the same prefixes in every guild
+type StaticPrefixes []string
+
+// Prefixes returns p
+func (p StaticPrefixes) Prefixes(string) []string {
+	return p
+}
+
+// preferred returns the prefix shown to users of guildID, or def if there are none
+func preferred(prefixes PrefixResolver, guildID, def string) string {
+	if prefixes != nil {
+		for _, p := range prefixes.Prefixes(guildID) {
+			if p != "" {
+				return p
+			}
+		}
+	}
+	return def
+}
+
+// matchPrefix returns the longest of the prefixes content starts with and what's left of content after it.
+// Prefixes match regardless of case. A prefix ending in a letter or digit must be followed by
+// whitespace or the end of content, so `thronebotweekly` doesn't match `thronebot`.
+func matchPrefix(content string, prefixes []string) (prefix, rest string, ok bool) {
+	sorted := append([]string(nil), prefixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, p := range sorted {
+		if p == "" || len(content) < len(p) || !strings.EqualFold(content[:len(p)], p) {
+			continue
+		}
+
+		rest := content[len(p):]
+		next, _ := utf8.DecodeRuneInString(rest)
+		if rest != "" && wordy(p) && !unicode.IsSpace(next) {
+			continue
+		}
+		return p, strings.TrimLeftFunc(rest, unicode.IsSpace), true
+	}
+	return "", "", false
+}
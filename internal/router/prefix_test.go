@@ -0,0 +1,96 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	for _, c := range []struct {
+		content  string
+		prefixes []string
+		prefix   string
+		rest     string
+		ok       bool
+	}{
+		{"thronebot weekly", []string{"thronebot"}, "thronebot", "weekly", true},
+		{"thronebotweekly", []string{"thronebot"}, "", "", false},
+		{"ThroneBot weekly", []string{"thronebot"}, "thronebot", "weekly", true},
+		{"thronebot", []string{"thronebot"}, "thronebot", "", true},
+		{"thronebot\tweekly", []string{"thronebot"}, "thronebot", "weekly", true},
+		{"!tb weekly", []string{"!tb"}, "!tb", "weekly", true},
+		{"!tbweekly", []string{"!tb"}, "", "", false},
+		{"!TB weekly", []string{"!tb"}, "!tb", "weekly", true},
+		{"!weekly", []string{"!"}, "!", "weekly", true},
+		{"! weekly", []string{"!"}, "!", "weekly", true},
+		{"tb! weekly", []string{"tb!"}, "tb!", "weekly", true},
+		{"tb!weekly", []string{"tb!"}, "tb!", "weekly", true},
+		{"!tb weekly", []string{"!", "!tb"}, "!tb", "weekly", true},
+		{"!tb weekly", []string{"!tb", "!"}, "!tb", "weekly", true},
+		{"!tbweekly", []string{"!", "!tb"}, "!", "tbweekly", true},
+		{"<@42> weekly", []string{"<@42>", "<@!42>", "!"}, "<@42>", "weekly", true},
+		{"<@!42> weekly", []string{"<@42>", "<@!42>", "!"}, "<@!42>", "weekly", true},
+		{"<@42>weekly", []string{"<@42>"}, "<@42>", "weekly", true},
+		{"<@43> weekly", []string{"<@42>", "<@!42>"}, "", "", false},
+		{"weekly", []string{"thronebot", "!"}, "", "", false},
+		{"weekly", []string{""}, "", "", false},
+		{"th", []string{"thronebot"}, "", "", false},
+	} {
+		prefix, rest, ok := matchPrefix(c.content, c.prefixes)
+		if prefix != c.prefix || rest != c.rest || ok != c.ok {
+			t.Errorf("%q with %q: got %q, %q, %v, want %q, %q, %v", c.content, c.prefixes, prefix, rest, ok, c.prefix, c.rest, c.ok)
+		}
+	}
+}
+
+func TestFindAndExecutePrefixes(t *testing.T) {
+	ses, _ := newTestSession(t)
+	ses.State.User = &discordgo.User{ID: "42", Username: "thronebot"}
+
+	var ran []string
+	r := NewRoute()
+	r.On("weekly", nil).On("history", func(ctx *Context) {
+		ran = append(ran, ctx.Prefix+" "+ctx.Args.Get(0))
+	})
+
+	prefixes := PrefixFunc(func(guildID string) []string {
+		switch guildID {
+		case "g1":
+			return []string{"!tb", "thronebot"}
+		case "g2":
+			return []string{"?"}
+		}
+		return []string{"thronebot"}
+	})
+
+	for _, c := range []struct {
+		guildID, content string
+		want             string
+	}{
+		{"g1", "!tb weekly history", "!tb weekly history"},
+		{"g1", "THRONEBOT weekly history", "thronebot weekly history"},
+		{"g1", "?weekly history", ""},
+		{"g2", "?weekly history", "? weekly history"},
+		{"g2", "!tb weekly history", ""},
+		{"g2", "thronebotweekly history", ""},
+		{"g2", "<@42> weekly history", "@thronebot weekly history"},
+		{"g2", "<@!42> weekly history", "@thronebot weekly history"},
+		{"g3", "thronebot weekly history", "thronebot weekly history"},
+		{"g3", "thronebot unknown", ""},
+	} {
+		ran = nil
+		err := r.FindAndExecute(ses, prefixes, "42", &discordgo.Message{GuildID: c.guildID, ChannelID: "c1", Content: c.content})
+
+		if c.want == "" {
+			if err == nil || len(ran) > 0 {
+				t.Errorf("%s %q: ran %q, %v, want no route", c.guildID, c.content, ran, err)
+			}
+			continue
+		}
+
+		if err != nil || len(ran) != 1 || ran[0] != c.want {
+			t.Errorf("%s %q: ran %q, %v, want %q", c.guildID, c.content, ran, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/necroforger/dgrouter"
+)
+
+// ArgKind is how a typed argument of a route is parsed
+type ArgKind int
+
+// Argument kinds
+const (
+	// ArgString is a single word
+	ArgString ArgKind = iota
+	// ArgInt is a whole number, between Min and Max if either is set
+	ArgInt
+	// ArgDuration is a duration like `2w`, `10d` or `12h`, see ParseDuration
+	ArgDuration
+	// ArgChannel is a channel mention or ID. Its value is the channel ID.
+	ArgChannel
+	// ArgUser is a user mention or ID. Its value is the user ID.
+	ArgUser
+	// ArgRole is a role mention or ID. Its value is the role ID.
+	ArgRole
+	// ArgEnum is one of Choices, in any case
+	ArgEnum
+	// ArgItem is one or more words accepted by Parse, ex. the name of a game item
+	ArgItem
+	// ArgRest is the rest of the line
+	ArgRest
+	// ArgFlag is true if its name is given, ex. `global`
+	ArgFlag
+)
+
+// Arg is a typed argument of a route. The router parses the arguments of a route in the order they were
+// declared in before calling its handler, and replies with the usage of the route if they're invalid.
+type Arg struct {
+	Name string
+	Desc string
+	Kind ArgKind
+
+	Required bool
+	// Choices are the values an ArgEnum accepts
+	Choices []string
+	// Min and Max bound an ArgInt, unless both are zero
+	Min, Max int
+	// Prefix makes the argument a named one that can be given anywhere, after the prefix.
+	// Ex. `--format html` or `| reason`.
+	Prefix string
+	// Parse parses an ArgItem. values are the arguments parsed so far.
+	Parse func(value string, values Values) (interface{}, error)
+	// Complete suggests values in slash commands, see Option
+	Complete func(value string, opts map[string]string) []string
+}
+
+// Values are the parsed arguments of a route by name. Arguments that weren't given are left out.
+type Values map[string]interface{}
+
+// Has reports whether the argument name was given
+func (v Values) Has(name string) bool {
+	_, ok := v[name]
+	return ok
+}
+
+// String returns the argument name as a string, or an empty string
+func (v Values) String(name string) string {
+	s, _ := v[name].(string)
+	return s
+}
+
+// Int returns the argument name as an int, or def if it wasn't given
+func (v Values) Int(name string, def int) int {
+	if n, ok := v[name].(int); ok {
+		return n
+	}
+	return def
+}
+
+// Duration returns the argument name as a duration, or 0
+func (v Values) Duration(name string) time.Duration {
+	d, _ := v[name].(time.Duration)
+	return d
+}
+
+// Bool returns the argument name as a bool, or false
+func (v Values) Bool(name string) bool {
+	b, _ := v[name].(bool)
+	return b
+}
+
+// Args sets the typed arguments of the route. Unless Options is called as well,
+// they're also the options of the route's slash command.
+func (r *Route) Args(args ...*Arg) *Route {
+	updateInfo(r.Route, func(i *info) {
+		i.args = args
+		i.hasArgs = true
+	})
+	return r
+}
+
+// option converts the argument to an option of a slash command
+func (a *Arg) option() *Option {
+	o := &Option{
+		Name:     a.Name,
+		Desc:     a.Desc,
+		Type:     OptionString,
+		Required: a.Required,
+		Choices:  a.Choices,
+		Prefix:   a.Prefix,
+		Complete: a.Complete,
+	}
+
+	switch a.Kind {
+	case ArgInt:
+		o.Type = OptionInteger
+	case ArgChannel:
+		o.Type = OptionChannel
+	case ArgUser:
+		o.Type = OptionUser
+	case ArgRole:
+		o.Type = OptionRole
+	case ArgFlag:
+		o.Type = OptionBoolean
+	}
+	return o
+}
+
+var errInvalidDuration = errors.New("invalid duration, expected something like `2w`, `10d` or `12h`")
+
+// ParseDuration parses a duration made of a number followed by a unit of
+// weeks (w), days (d) or hours (h). Ex. `2w`, `10d`.
+func ParseDuration(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, errInvalidDuration
+	}
+
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, errInvalidDuration
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'h':
+		unit = time.Hour
+	default:
+		return 0, errInvalidDuration
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// snowflake returns the ID in a mention like `<#id>`, or s itself if it's an ID
+func snowflake(s string, prefixes ...string) (string, bool) {
+	if strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
+		inner := s[1 : len(s)-1]
+		for _, p := range prefixes {
+			if strings.HasPrefix(inner, p) {
+				s = strings.TrimPrefix(inner, p)
+				break
+			}
+		}
+	}
+
+	if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// parseWord parses the value of a single word argument
+func (a *Arg) parseWord(w string, values Values) (interface{}, error) {
+	switch a.Kind {
+	case ArgInt:
+		n, err := strconv.Atoi(w)
+		bounded := a.Min != 0 || a.Max != 0
+		if err != nil || bounded && (n < a.Min || n > a.Max) {
+			if bounded {
+				return nil, fmt.Errorf("`%s` must be a whole number from %d to %d", a.Name, a.Min, a.Max)
+			}
+			return nil, fmt.Errorf("`%s` must be a whole number", a.Name)
+		}
+		return n, nil
+	case ArgDuration:
+		d, err := ParseDuration(w)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` must be a duration, ex. `2w`, `10d` or `12h`", a.Name)
+		}
+		return d, nil
+	case ArgChannel:
+		if id, ok := snowflake(w, "#"); ok {
+			return id, nil
+		}
+		return nil, fmt.Errorf("`%s` must be a channel, ex. <#id>", a.Name)
+	case ArgUser:
+		if id, ok := snowflake(w, "@!", "@"); ok {
+			return id, nil
+		}
+		return nil, fmt.Errorf("`%s` must be a user, ex. <@id>", a.Name)
+	case ArgRole:
+		if id, ok := snowflake(w, "@&"); ok {
+			return id, nil
+		}
+		return nil, fmt.Errorf("`%s` must be a role, ex. <@&id>", a.Name)
+	case ArgEnum:
+		for _, c := range a.Choices {
+			if strings.EqualFold(w, c) {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("`%s` must be one of %s", a.Name, strings.Join(a.Choices, ", "))
+	case ArgItem:
+		if a.Parse == nil {
+			return w, nil
+		}
+		return a.Parse(w, values)
+	}
+	return w, nil
+}
+
+// wordy reports whether s ends in a letter or digit, so it must be separated from what follows by a space
+func wordy(s string) bool {
+	if s == "" {
+		return false
+	}
+	r := []rune(s)
+	return unicode.IsLetter(r[len(r)-1]) || unicode.IsDigit(r[len(r)-1])
+}
+
+// extract removes the argument a, which has a prefix, from words. The value is the word after the prefix,
+// or every word after it for ArgRest. Prefixes which don't end in a letter or digit may touch the value,
+// ex. `death|too easy`.
+func (a *Arg) extract(words []string) (rest []string, value string, ok bool) {
+	p := a.Prefix
+	for k, w := range words {
+		var before, after string
+		switch {
+		case strings.EqualFold(w, p):
+		case len(w) > len(p) && strings.EqualFold(w[:len(p)+1], p+"="):
+			after = w[len(p)+1:]
+		case !wordy(p) && strings.Contains(w, p):
+			i := strings.Index(w, p)
+			before, after = w[:i], w[i+len(p):]
+		default:
+			continue
+		}
+
+		rest = append(rest, words[:k]...)
+		if before != "" {
+			rest = append(rest, before)
+		}
+
+		tail := words[k+1:]
+		if after == "" && a.Kind != ArgRest && len(tail) > 0 {
+			after, tail = tail[0], tail[1:]
+		}
+
+		if a.Kind == ArgRest {
+			value = strings.TrimSpace(strings.Join(append([]string{after}, tail...), string(separator)))
+			return rest, value, true
+		}
+		return append(rest, tail...), after, true
+	}
+	return words, "", false
+}
+
+// parseArgs parses words according to args
+func parseArgs(args []*Arg, words []string) (Values, error) {
+	values := make(Values)
+
+	var positional []*Arg
+	for _, a := range args {
+		if a.Prefix == "" {
+			positional = append(positional, a)
+			continue
+		}
+
+		var value string
+		var ok bool
+		if words, value, ok = a.extract(words); !ok && !a.Required {
+			continue
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("Missing `%s`", a.Name)
+		}
+
+		v := interface{}(value)
+		if a.Kind != ArgRest {
+			var err error
+			if v, err = a.parseWord(value, values); err != nil {
+				return nil, err
+			}
+		}
+		values[a.Name] = v
+	}
+
+	var nonEmpty []string
+	for _, w := range words {
+		if w != "" {
+			nonEmpty = append(nonEmpty, w)
+		}
+	}
+
+	if err := parsePositional(positional, nonEmpty, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parsePositional parses words according to args, storing the results in values
+func parsePositional(args []*Arg, words []string, values Values) error {
+	if len(args) == 0 {
+		if len(words) > 0 {
+			return fmt.Errorf("Unexpected `%s`", strings.Join(words, string(separator)))
+		}
+		return nil
+	}
+
+	a := args[0]
+	if len(words) == 0 {
+		if a.Required {
+			return fmt.Errorf("Missing `%s`", a.Name)
+		}
+		return parsePositional(args[1:], words, values)
+	}
+
+	switch a.Kind {
+	case ArgFlag:
+		if strings.EqualFold(words[0], a.Name) {
+			values[a.Name] = true
+			words = words[1:]
+		}
+		return parsePositional(args[1:], words, values)
+	case ArgRest:
+		values[a.Name] = strings.Join(words, string(separator))
+		return parsePositional(args[1:], nil, values)
+	case ArgItem:
+		return parseItem(a, args[1:], words, values)
+	}
+
+	v, err := a.parseWord(words[0], values)
+	if err != nil {
+		return err
+	}
+	values[a.Name] = v
+	return parsePositional(args[1:], words[1:], values)
+}
+
+// parseItem parses the item a, which may be several words long, and the arguments after it.
+// The item takes as many words as it can while the rest still parse. If none are accepted, the error is about
+// the shortest words the rest parse after, ex. `supr crossbow` in `supr crossbow 2w`.
+func parseItem(a *Arg, args []*Arg, words []string, values Values) error {
+	var itemErr, restErr error
+	for n := len(words); n > 0; n-- {
+		rest := make(Values)
+		for k, v := range values {
+			rest[k] = v
+		}
+
+		if err := parsePositional(args, words[n:], rest); err != nil {
+			if restErr == nil {
+				restErr = err
+			}
+			continue
+		}
+
+		v, err := a.parseWord(strings.Join(words[:n], string(separator)), values)
+		if err != nil {
+			itemErr = err
+			continue
+		}
+
+		for k, v := range rest {
+			values[k] = v
+		}
+		values[a.Name] = v
+		return nil
+	}
+
+	if itemErr != nil {
+		return itemErr
+	}
+	return restErr
+}
+
+// typed parses the arguments of the context's route before calling fn
+func typed(fn HandlerFunc) HandlerFunc {
+	if fn == nil {
+		return nil
+	}
+
+	return func(ctx *Context) {
+		i := getInfo(ctx.Route)
+		if !i.hasArgs {
+			fn(ctx)
+			return
+		}
+
+		var words []string
+		if len(ctx.Args) > 1 {
+			words = ctx.Args[1:]
+		}
+
+		values, err := parseArgs(i.args, words)
+		if err != nil {
+			ctx.Reply(err, "\nUsage: `", usage(ctx.Route, ctx.Prefix), "`")
+			return
+		}
+
+		ctx.Values = values
+		fn(ctx)
+	}
+}
+
+// withPrefix puts prefix in front of the command name. Prefixes without letters or digits, like `!` or `/`,
+// are written without a space.
+func withPrefix(prefix, name string) string {
+	if strings.IndexFunc(prefix, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) == -1 {
+		return prefix + name
+	}
+	return prefix + " " + name
+}
+
+// usage returns the usage text of the route, generated from its arguments if it didn't set one
+func usage(rt *dgrouter.Route, prefix string) string {
+	i := getInfo(rt)
+	if !i.hasArgs && i.usage != "" {
+		return i.usage
+	}
+
+	parts := []string{withPrefix(prefix, fullName(rt))}
+	for _, a := range i.args {
+		var s string
+		switch {
+		case a.Kind == ArgFlag:
+			s = a.Name
+		case a.Kind == ArgEnum && a.Prefix == "":
+			s = strings.Join(a.Choices, "|")
+		case a.Kind == ArgEnum:
+			s = a.Prefix + " " + strings.Join(a.Choices, "|")
+		case a.Prefix != "":
+			s = a.Prefix + " " + a.Name
+		default:
+			s = a.Name
+		}
+
+		if a.Required && a.Kind != ArgFlag {
+			parts = append(parts, "("+s+")")
+		} else {
+			parts = append(parts, "["+s+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,244 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// sentRequest is a request made to Discord. Body is the decoded JSON body, if any.
+type sentRequest struct {
+	Method, Path string
+	Body         map[string]interface{}
+}
+
+// recorder answers every request with an empty JSON object and records it
+type recorder struct {
+	mu   sync.Mutex
+	sent []sentRequest
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	sr := sentRequest{Method: req.Method, Path: req.URL.Path}
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal(b, &sr.Body)
+	}
+
+	r.mu.Lock()
+	r.sent = append(r.sent, sr)
+	r.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func (r *recorder) requests() []sentRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sentRequest(nil), r.sent...)
+}
+
+// newTestSession returns a session whose requests are recorded by the returned recorder instead of sent
+func newTestSession(t *testing.T) (*discordgo.Session, *recorder) {
+	ses, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := new(recorder)
+	ses.Client = &http.Client{Transport: rec}
+	return ses, rec
+}
+
+var testItems = []string{"crown of death", "super crossbow", "gl"}
+
+func parseTestItem(value string, _ Values) (interface{}, error) {
+	for _, item := range testItems {
+		if strings.EqualFold(value, item) {
+			return item, nil
+		}
+	}
+	return nil, errors.New("unknown item `" + value + "`")
+}
+
+// banArgs are arguments like the ones of `weekly ban`
+func banArgs() []*Arg {
+	return []*Arg{
+		{Name: "action", Kind: ArgEnum, Required: true, Choices: []string{"add", "del"}},
+		{Name: "name", Kind: ArgItem, Required: true, Parse: parseTestItem},
+		{Name: "duration", Kind: ArgDuration},
+		{Name: "format", Kind: ArgEnum, Prefix: "--format", Choices: []string{"md", "html"}},
+		{Name: "reason", Kind: ArgRest, Prefix: "|"},
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	for _, c := range []struct {
+		args []*Arg
+		line string
+		want Values
+		err  string
+	}{
+		{banArgs(), "add gl", Values{"action": "add", "name": "gl"}, ""},
+		{banArgs(), "DEL Crown Of Death", Values{"action": "del", "name": "crown of death"}, ""},
+		{banArgs(), "add crown of death 2w", Values{"action": "add", "name": "crown of death", "duration": 2 * week}, ""},
+		{banArgs(), "add super crossbow 10d | too easy", Values{"action": "add", "name": "super crossbow", "duration": 10 * 24 * time.Hour, "reason": "too easy"}, ""},
+		{banArgs(), "add super crossbow|too easy", Values{"action": "add", "name": "super crossbow", "reason": "too easy"}, ""},
+		{banArgs(), "add gl 12h|too | easy", Values{"action": "add", "name": "gl", "duration": 12 * time.Hour, "reason": "too | easy"}, ""},
+		{banArgs(), "add gl |too easy", Values{"action": "add", "name": "gl", "reason": "too easy"}, ""},
+		{banArgs(), "--format html add gl", Values{"action": "add", "name": "gl", "format": "html"}, ""},
+		{banArgs(), "add gl --format=HTML 1w", Values{"action": "add", "name": "gl", "format": "html", "duration": week}, ""},
+		{banArgs(), "add super crossbow --format md 1w | reason", Values{"action": "add", "name": "super crossbow", "format": "md", "duration": week, "reason": "reason"}, ""},
+
+		{banArgs(), "", nil, "Missing `action`"},
+		{banArgs(), "add", nil, "Missing `name`"},
+		{banArgs(), "ban gl", nil, "`action` must be one of add, del"},
+		{banArgs(), "add supr crossbow 2w", nil, "unknown item `supr crossbow`"},
+		{banArgs(), "add gl --format", nil, "Missing `format`"},
+		{banArgs(), "add gl --format pdf", nil, "`format` must be one of md, html"},
+		{banArgs(), "add gl |", nil, "Missing `reason`"},
+		{[]*Arg{{Name: "duration", Kind: ArgDuration, Required: true}}, "2x", nil, "`duration` must be a duration, ex. `2w`, `10d` or `12h`"},
+		{[]*Arg{{Name: "duration", Kind: ArgDuration, Required: true}}, "0w", nil, "`duration` must be a duration, ex. `2w`, `10d` or `12h`"},
+
+		{
+			[]*Arg{{Name: "n", Kind: ArgInt, Min: 1, Max: 10}, {Name: "channel", Kind: ArgChannel}, {Name: "global", Kind: ArgFlag}},
+			"5 <#123> global",
+			Values{"n": 5, "channel": "123", "global": true},
+			"",
+		},
+		{[]*Arg{{Name: "n", Kind: ArgInt}, {Name: "user", Kind: ArgUser}}, "-1 <@!42>", Values{"n": -1, "user": "42"}, ""},
+		{[]*Arg{{Name: "n", Kind: ArgInt, Min: 1, Max: 10}}, "11", nil, "`n` must be a whole number from 1 to 10"},
+		{[]*Arg{{Name: "n", Kind: ArgInt}}, "five", nil, "`n` must be a whole number"},
+		{[]*Arg{{Name: "channel", Kind: ArgChannel}}, "#general", nil, "`channel` must be a channel, ex. <#id>"},
+		{[]*Arg{{Name: "role", Kind: ArgRole}}, "<@42>", nil, "`role` must be a role, ex. <@&id>"},
+		{[]*Arg{{Name: "n", Kind: ArgInt}}, "1 2", nil, "Unexpected `2`"},
+		{[]*Arg{{Name: "text", Kind: ArgRest}}, "a b  c", Values{"text": "a b c"}, ""},
+	} {
+		var words []string
+		if c.line != "" {
+			words = strings.Split(c.line, " ")
+		}
+
+		got, err := parseArgs(c.args, words)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%q: got error %v, want %q", c.line, err, c.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", c.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"2w", 14 * 24 * time.Hour},
+		{"10d", 240 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"w", 0},
+		{"0d", 0},
+		{"-1d", 0},
+		{"3m", 0},
+		{"", 0},
+	} {
+		got, err := ParseDuration(c.in)
+		if c.want == 0 {
+			if err == nil {
+				t.Errorf("%q: got %s, want an error", c.in, got)
+			}
+			continue
+		}
+
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %s, %v, want %s", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	r := NewRoute()
+	weekly := r.On("weekly", func(*Context) {})
+
+	var ran bool
+	ban := weekly.On("ban", func(*Context) { ran = true }).Args(banArgs()...)
+	flags := weekly.On("history", nil).Args(
+		&Arg{Name: "n", Kind: ArgInt},
+		&Arg{Name: "global", Kind: ArgFlag},
+		&Arg{Name: "channel", Kind: ArgChannel, Required: true, Prefix: "in"},
+	)
+	custom := weekly.On("set", nil).Usage("thronebot weekly set (build)")
+
+	for _, c := range []struct {
+		rt     *Route
+		prefix string
+		want   string
+	}{
+		{ban, "!", "!weekly ban (add|del) (name) [duration] [--format md|html] [| reason]"},
+		{ban, "thronebot", "thronebot weekly ban (add|del) (name) [duration] [--format md|html] [| reason]"},
+		{flags, "!tb", "!tb weekly history [n] [global] (in channel)"},
+		{custom, "!", "thronebot weekly set (build)"},
+	} {
+		if got := usage(c.rt.Route, c.prefix); got != c.want {
+			t.Errorf("got usage %q, want %q", got, c.want)
+		}
+	}
+
+	ses, rec := newTestSession(t)
+	for _, c := range []struct {
+		line string
+		err  string
+	}{
+		{"add", "Missing `name`"},
+		{"add gl 2x", "unknown item `gl 2x`"},
+		{"add gl", ""},
+	} {
+		ran = false
+		before := len(rec.requests())
+
+		args := append(Args{"weekly ban"}, strings.Split(c.line, " ")...)
+		ctx := NewContext(ses, &discordgo.Message{ChannelID: "c1", Content: "!weekly ban " + c.line}, args, ban.Route)
+		ctx.Prefix = "!"
+		ban.Handler(ctx)
+
+		sent := rec.requests()[before:]
+		if c.err == "" {
+			if !ran || len(sent) > 0 {
+				t.Errorf("%q: handler ran %v, replied %v", c.line, ran, sent)
+			}
+			continue
+		}
+
+		want := c.err + "\nUsage: `!weekly ban (add|del) (name) [duration] [--format md|html] [| reason]`"
+		if ran || len(sent) != 1 || sent[0].Body["content"] != want {
+			t.Errorf("%q: handler ran %v, replied %v, want %q", c.line, ran, sent, want)
+		}
+	}
+}
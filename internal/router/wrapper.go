@@ -34,9 +34,32 @@ func (r *Route) Desc(desc string) *Route {
 	return r
 }
 
+// Usage sets the usage text of the route, shown in help. Ex. `thronebot weekly history [n]`
+func (r *Route) Usage(usage string) *Route {
+	updateInfo(r.Route, func(i *info) { i.usage = usage })
+	return r
+}
+
+// Alias adds aliases the route can also be called by
+func (r *Route) Alias(aliases ...string) *Route {
+	r.Route.Alias(aliases...)
+	return r
+}
+
+// Require restricts every route added to r after this call to users with the permission p.
+// Like Use, it doesn't affect r itself or routes that were already added.
+func (r *Route) Require(p *Permission) *Route {
+	updateInfo(r.Route, func(i *info) { i.childPermission = p })
+	return r.Use(p.Middleware())
+}
+
 // On matches a Route with a name
 func (r *Route) On(name string, handler HandlerFunc) *Route {
-	return &Route{r.Route.On(name, WrapHandler(handler))}
+	rt := r.Route.On(name, WrapHandler(typed(handler)))
+	if p := getInfo(r.Route).childPermission; p != nil {
+		updateInfo(rt, func(i *info) { i.permission = p })
+	}
+	return &Route{rt}
 }
 
 // Group groups multiple routes together
@@ -93,39 +116,43 @@ func nickMention(s string) string {
 	return "<@!" + s + ">"
 }
 
-// FindAndExecute finds the closest command and executes the callback
-func (r *Route) FindAndExecute(s *discordgo.Session, prefix string, botID string, m *discordgo.Message) error {
-	var pf string
-
+// FindAndExecute finds the closest command and executes the callback.
+// Commands start with one of the guild's prefixes from prefixes or a mention of the bot.
+func (r *Route) FindAndExecute(s *discordgo.Session, prefixes PrefixResolver, botID string, m *discordgo.Message) error {
 	if r.Default != nil && (m.Content == mention(botID) || m.Content == nickMention(botID)) {
 		r.Default.Handler(NewContext(s, m, ParseArgs(m.Content), r.Default))
 		return nil
 	}
 
-	bmention := mention(botID)
-	nmention := nickMention(botID)
+	guildID := m.GuildID
+	if guildID == "" {
+		if ch, err := s.State.Channel(m.ChannelID); err == nil {
+			guildID = ch.GuildID
+		}
+	}
 
-	p := func(t string) bool {
-		return strings.HasPrefix(m.Content, t)
+	pfs := []string{mention(botID), nickMention(botID)}
+	if prefixes != nil {
+		pfs = append(pfs, prefixes.Prefixes(guildID)...)
 	}
 
-	switch {
-	case prefix != "" && p(prefix):
-		pf = prefix
-	case p(bmention):
-		pf = bmention
-	case p(nmention):
-		pf = nmention
-	default:
+	prefix, command, ok := matchPrefix(m.Content, pfs)
+	if !ok {
 		return errRouteNotFound
 	}
 
-	command := strings.TrimPrefix(m.Content, pf)
 	args := ParseArgs(command)
 
 	if rt, depth := r.FindFull(args...); depth > 0 {
 		args = append([]string{strings.Join(args[:depth], string(separator))}, args[depth:]...)
-		rt.Handler(NewContext(s, m, args, rt))
+		// Mentions look like `<@id>` in code blocks, so usage is shown with the bot's name instead
+		if prefix == mention(botID) || prefix == nickMention(botID) {
+			prefix = "@" + s.State.User.Username
+		}
+
+		ctx := NewContext(s, m, args, rt)
+		ctx.Prefix = prefix
+		rt.Handler(ctx)
 	} else {
 		return errRouteNotFound
 	}
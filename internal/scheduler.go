@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Scheduler runs the weekly cycle: it closes voting, announces the winning
+// suggestion, archives the week's suggestions and resets suggestion counts
+type Scheduler struct {
+	Store WeeklyStore
+	Ses   *discordgo.Session
+
+	// Day, Hour and Minute are when the cycle runs, in UTC. Use SetSchedule to change them once started.
+	Day          time.Weekday
+	Hour, Minute int
+	mu           sync.Mutex
+
+	// Channels returns the channels the results are announced in
+	Channels func() []string
+
+	stop chan struct{}
+}
+
+// ParseSchedule parses a weekday name and a 24 hour `HH:MM` clock time
+func ParseSchedule(day, clock string) (time.Weekday, int, int, error) {
+	wd := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(day, d.String()) {
+			wd = int(d)
+		}
+	}
+
+	if wd == -1 {
+		return 0, 0, 0, fmt.Errorf("scheduler: invalid weekday %q", day)
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("scheduler: invalid time %q, expected HH:MM", clock)
+	}
+
+	return time.Weekday(wd), t.Hour(), t.Minute(), nil
+}
+
+// lastDue returns the most recent scheduled time at or before now
+func (sc *Scheduler) lastDue(now time.Time) time.Time {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now = now.UTC()
+	due := time.Date(now.Year(), now.Month(), now.Day(), sc.Hour, sc.Minute, 0, 0, time.UTC)
+	due = due.AddDate(0, 0, -int((now.Weekday()-sc.Day+7)%7))
+	if due.After(now) {
+		due = due.AddDate(0, 0, -7)
+	}
+	return due
+}
+
+// SetSchedule changes when the cycle runs. If the new schedule's most recent run is after
+// the last cycle it is recorded as run, so moving the schedule never closes a week early.
+func (sc *Scheduler) SetSchedule(day time.Weekday, hour, minute int) error {
+	last, err := sc.Store.LastCycle()
+	if err != nil {
+		return err
+	}
+
+	// Record the skipped run before switching, so the running loop can't see it as due
+	next := &Scheduler{Day: day, Hour: hour, Minute: minute}
+	if due := next.lastDue(time.Now()); last.Before(due) {
+		if err = sc.Store.SetLastCycle(due); err != nil {
+			return err
+		}
+	}
+
+	sc.mu.Lock()
+	sc.Day, sc.Hour, sc.Minute = day, hour, minute
+	sc.mu.Unlock()
+	return nil
+}
+
+// Start starts the scheduler in the background
+func (sc *Scheduler) Start() error {
+	last, err := sc.Store.LastCycle()
+	if err != nil {
+		return err
+	}
+
+	// Don't close a week that was never tracked on a fresh database
+	if last.IsZero() {
+		if err = sc.Store.SetLastCycle(sc.lastDue(time.Now())); err != nil {
+			return err
+		}
+	}
+
+	sc.stop = make(chan struct{})
+	go sc.loop()
+	return nil
+}
+
+// Stop stops the scheduler
+func (sc *Scheduler) Stop() {
+	if sc.stop != nil {
+		close(sc.stop)
+	}
+}
+
+func (sc *Scheduler) loop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		sc.check(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-sc.stop:
+			return
+		}
+	}
+}
+
+func (sc *Scheduler) check(now time.Time) {
+	last, err := sc.Store.LastCycle()
+	if err != nil {
+		log.Println("scheduler:", err)
+		return
+	}
+
+	due := sc.lastDue(now)
+	if last.Before(due) {
+		if err = sc.RunCycle(due); err != nil {
+			log.Println("scheduler: weekly cycle failed:", err)
+		}
+	}
+}
+
+// RunCycle closes the week that ended at due
+func (sc *Scheduler) RunCycle(due time.Time) error {
+	week := due.Format("2006-01-02")
+	suggestions, err := sc.Store.CloseWeek(week, due)
+	if err == ErrWeekClosed {
+		log.Println("scheduler: week", week, "was already closed by another instance")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var winner *Suggestion
+	if len(suggestions) > 0 {
+		winner = suggestions[0]
+	}
+
+	log.Println("scheduler: closed week", week, "with", len(suggestions), "suggestions")
+	sc.announce(week, winner)
+	return nil
+}
+
+func (sc *Scheduler) announce(week string, winner *Suggestion) {
+	embed := &discordgo.MessageEmbed{
+		Title: "Weekly voting closed for " + week,
+		Color: 0xf5b700,
+	}
+
+	if winner == nil {
+		embed.Description = "There were no suggestions this week."
+	} else {
+		embed.Description = fmt.Sprintf(
+			"The winning suggestion is **%s** by <@%s> with %d %s and %d %s.",
+			winner.Build.String(), winner.UserID,
+			winner.Up, VoteUp, winner.Down, VoteDown,
+		)
+	}
+
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: "Suggestion counts have been reset."}
+
+	for _, channel := range sc.Channels() {
+		if _, err := sc.Ses.ChannelMessageSendEmbed(channel, embed); err != nil {
+			log.Println("scheduler: failed to announce winner:", err)
+		}
+	}
+}
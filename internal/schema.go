@@ -0,0 +1,491 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migration is a single versioned change to the database schema
+type migration struct {
+	version int
+	name    string
+	up      func(tx *Tx) error
+}
+
+// sqliteMigrations and postgresMigrations are applied in order to bring a database up to date.
+// Never change a migration once it has been released, add a new one instead.
+var (
+	sqliteMigrations = []migration{
+		{1, "create tables", createTables},
+		{2, "migrate weekly_banned to weekly_bans", migrateWeeklyBanned},
+		{3, "add an id primary key to weekly_suggestions", addSuggestionIDs},
+	}
+
+	postgresMigrations = []migration{
+		{1, "create tables", createPostgresTables},
+	}
+)
+
+// schema holds every table the bot uses on SQLite as of the first migration.
+// The statements are idempotent so databases created before migrations existed can be adopted.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS weekly_suggestions (
+		uid   TEXT NOT NULL,
+		char  TEXT NOT NULL,
+		skin  INTEGER NOT NULL,
+		weap  TEXT NOT NULL,
+		crown TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS user_suggestions (
+		id    TEXT PRIMARY KEY,
+		count INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_bans (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind       TEXT NOT NULL,
+		item_id    INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		banned_by  TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT,
+		UNIQUE(kind, item_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_votes (
+		suggestion_id INTEGER PRIMARY KEY,
+		message_id    TEXT UNIQUE,
+		up            INTEGER NOT NULL DEFAULT 0,
+		down          INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS suggestion_mutations (
+		suggestion_id INTEGER PRIMARY KEY,
+		mutations     TEXT NOT NULL DEFAULT '',
+		ultra         TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE IF NOT EXISTS suggestion_archive (
+		week          TEXT NOT NULL,
+		suggestion_id INTEGER NOT NULL,
+		uid           TEXT NOT NULL,
+		char          TEXT NOT NULL,
+		skin          INTEGER NOT NULL,
+		weap          TEXT NOT NULL,
+		crown         TEXT NOT NULL,
+		up            INTEGER NOT NULL,
+		down          INTEGER NOT NULL,
+		winner        INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_history (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		char   TEXT NOT NULL,
+		skin   INTEGER NOT NULL,
+		weap   TEXT NOT NULL,
+		crown  TEXT NOT NULL,
+		set_by TEXT NOT NULL,
+		set_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS guild_settings (
+		guild_id           TEXT PRIMARY KEY,
+		prefix             TEXT,
+		staff_role         TEXT,
+		staff_channel      TEXT,
+		suggestion_channel TEXT,
+		voting_channel     TEXT,
+		archive_channel    TEXT,
+		suggestion_limit   INTEGER,
+		weekly_cooldown    INTEGER
+	);`,
+	`CREATE TABLE IF NOT EXISTS settings_audit (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id   TEXT NOT NULL,
+		setting    TEXT NOT NULL,
+		old_value  TEXT NOT NULL,
+		new_value  TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		changed_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS bot_state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+}
+
+// postgresSchema holds every table the bot uses on PostgreSQL as of its first migration
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS weekly_suggestions (
+		id     BIGSERIAL PRIMARY KEY,
+		uid    TEXT NOT NULL,
+		"char" TEXT NOT NULL,
+		skin   INTEGER NOT NULL,
+		weap   TEXT NOT NULL,
+		crown  TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS user_suggestions (
+		id    TEXT PRIMARY KEY,
+		count INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_bans (
+		id         BIGSERIAL PRIMARY KEY,
+		kind       TEXT NOT NULL,
+		item_id    INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		banned_by  TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT,
+		UNIQUE(kind, item_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_votes (
+		suggestion_id BIGINT PRIMARY KEY,
+		message_id    TEXT UNIQUE,
+		up            INTEGER NOT NULL DEFAULT 0,
+		down          INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS suggestion_mutations (
+		suggestion_id BIGINT PRIMARY KEY,
+		mutations     TEXT NOT NULL DEFAULT '',
+		ultra         TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE IF NOT EXISTS suggestion_archive (
+		week          TEXT NOT NULL,
+		suggestion_id BIGINT NOT NULL,
+		uid           TEXT NOT NULL,
+		"char"        TEXT NOT NULL,
+		skin          INTEGER NOT NULL,
+		weap          TEXT NOT NULL,
+		crown         TEXT NOT NULL,
+		mutations     TEXT NOT NULL DEFAULT '',
+		ultra         TEXT NOT NULL DEFAULT '',
+		up            INTEGER NOT NULL,
+		down          INTEGER NOT NULL,
+		winner        INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS weekly_history (
+		id        BIGSERIAL PRIMARY KEY,
+		"char"    TEXT NOT NULL,
+		skin      INTEGER NOT NULL,
+		weap      TEXT NOT NULL,
+		crown     TEXT NOT NULL,
+		mutations TEXT NOT NULL DEFAULT '',
+		ultra     TEXT NOT NULL DEFAULT '',
+		set_by    TEXT NOT NULL,
+		set_at    TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS guild_settings (
+		guild_id           TEXT PRIMARY KEY,
+		prefix             TEXT,
+		staff_role         TEXT,
+		staff_channel      TEXT,
+		suggestion_channel TEXT,
+		voting_channel     TEXT,
+		archive_channel    TEXT,
+		suggestion_limit   INTEGER,
+		weekly_cooldown    INTEGER
+	);`,
+	`CREATE TABLE IF NOT EXISTS settings_audit (
+		id         BIGSERIAL PRIMARY KEY,
+		guild_id   TEXT NOT NULL,
+		setting    TEXT NOT NULL,
+		old_value  TEXT NOT NULL,
+		new_value  TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		changed_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS bot_state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+}
+
+// columns holds columns added to the tables in schema by releases before migrations existed
+var columns = []struct{ table, name, def string }{
+	{"suggestion_archive", "mutations", "TEXT NOT NULL DEFAULT ''"},
+	{"suggestion_archive", "ultra", "TEXT NOT NULL DEFAULT ''"},
+	{"weekly_history", "mutations", "TEXT NOT NULL DEFAULT ''"},
+	{"weekly_history", "ultra", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Migrate applies every migration newer than the database's schema version and returns how many were applied
+func Migrate(db *DB) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`)
+	if err != nil {
+		log.Println("migrate: failed to create schema_version:", err)
+		return 0, err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations := db.Dialect.migrations
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return 0, fmt.Errorf("migrate: database schema version %d is newer than this build's %d", current, latest)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		ok, err := applyMigration(db, m)
+		if err != nil {
+			log.Println("migrate: migration", m.version, "("+m.name+") failed:", err)
+			return applied, err
+		}
+
+		if ok {
+			log.Println("migrate: applied migration", m.version, "("+m.name+")")
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// SchemaVersion returns the version of the newest migration applied to the database
+func SchemaVersion(db *DB) (int, error) {
+	var v sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version;").Scan(&v); err != nil {
+		log.Println("migrate: failed to read schema version:", err)
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// applyMigration applies m and reports whether it did. Migrations another instance
+// applied in the meantime are skipped.
+func applyMigration(db *DB, m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	if err = db.Dialect.lockMigrations(tx); err != nil {
+		return false, err
+	}
+
+	var n int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM schema_version WHERE version = ?;", m.version).Scan(&n); err != nil || n > 0 {
+		return false, err
+	}
+
+	if err = m.up(tx); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO schema_version(version, name, applied_at) VALUES(?, ?, ?);",
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// createPostgresTables creates every table on PostgreSQL
+func createPostgresTables(tx *Tx) error {
+	for _, stmt := range postgresSchema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTables creates any missing tables and columns on SQLite
+func createTables(tx *Tx) error {
+	for _, stmt := range schema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range columns {
+		ok, err := hasColumn(tx, c.table, c.name)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			continue
+		}
+
+		if _, err = tx.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.name + " " + c.def + ";"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSuggestionIDs gives weekly_suggestions a declared id key. Votes and mutations used to refer to suggestions
+// by their implicit rowid, which VACUUM may renumber, so each suggestion's rowid becomes its id.
+func addSuggestionIDs(tx *Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE weekly_suggestions_new (
+			id    INTEGER PRIMARY KEY AUTOINCREMENT,
+			uid   TEXT NOT NULL,
+			char  TEXT NOT NULL,
+			skin  INTEGER NOT NULL,
+			weap  TEXT NOT NULL,
+			crown TEXT NOT NULL
+		);`,
+		"INSERT INTO weekly_suggestions_new(id, uid, char, skin, weap, crown) SELECT rowid, uid, char, skin, weap, crown FROM weekly_suggestions;",
+		"DROP TABLE weekly_suggestions;",
+		"ALTER TABLE weekly_suggestions_new RENAME TO weekly_suggestions;",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oldBanColumns maps ban kinds to the column names used for them by the old
+// weekly_banned table, which had one column per kind
+var oldBanColumns = map[BanKind][]string{
+	BanChar:   {"chars", "char"},
+	BanCrown:  {"crowns", "crown"},
+	BanWeapon: {"weaps", "wep"},
+}
+
+// migrateWeeklyBanned moves bans from the old weekly_banned table into weekly_bans and drops it
+func migrateWeeklyBanned(tx *Tx) error {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'weekly_banned';").Scan(&n)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	// banned_by and expires_at only exist on tables that were in use with temporary bans
+	bannedBy, expires := "''", "NULL"
+	if ok, err := hasColumn(tx, "weekly_banned", "banned_by"); err != nil {
+		return err
+	} else if ok {
+		bannedBy = "IFNULL(banned_by, '')"
+	}
+
+	if ok, err := hasColumn(tx, "weekly_banned", "expires_at"); err != nil {
+		return err
+	} else if ok {
+		expires = "expires_at"
+	}
+
+	type source struct {
+		kind BanKind
+		col  string
+	}
+
+	var sources []source
+	for _, kind := range BanKinds {
+		for _, col := range oldBanColumns[kind] {
+			ok, err := hasColumn(tx, "weekly_banned", col)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				sources = append(sources, source{kind, col})
+			}
+		}
+	}
+
+	type legacyBan struct {
+		item, bannedBy string
+		expires        sql.NullString
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, src := range sources {
+		rows, err := tx.Query("SELECT " + src.col + ", " + bannedBy + ", " + expires + " FROM weekly_banned WHERE " + src.col + " IS NOT NULL;")
+		if err != nil {
+			return err
+		}
+
+		var bans []legacyBan
+		for rows.Next() {
+			var b legacyBan
+			if err = rows.Scan(&b.item, &b.bannedBy, &b.expires); err != nil {
+				rows.Close()
+				return err
+			}
+			bans = append(bans, b)
+		}
+
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, b := range bans {
+			id, ok := legacyItemID(src.kind, b.item)
+			if !ok {
+				log.Println("migrateWeeklyBanned: skipping ban of unknown", src.kind, "item:", b.item)
+				continue
+			}
+
+			_, err = tx.Exec(
+				"INSERT OR IGNORE INTO weekly_bans("+banColumns+") VALUES (?, ?, '', ?, ?, ?);",
+				string(src.kind), id, b.bannedBy, now, b.expires,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec("DROP TABLE weekly_banned;")
+	return err
+}
+
+// legacyItemID returns the ID of an item banned in weekly_banned, which stored IDs or names
+func legacyItemID(kind BanKind, item string) (int, bool) {
+	if id, err := strconv.Atoi(strings.TrimSpace(item)); err == nil {
+		return id, true
+	}
+
+	name, err := kind.Resolver().Resolve(item)
+	if err != nil {
+		return 0, false
+	}
+	return kind.Items().NameToID(name), true
+}
+
+func hasColumn(tx *Tx, table, column string) (bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ");")
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+
+		if err = rows.Scan(&cid, &name, &typ, &notnull, &dflt, &pk); err != nil {
+			return false, err
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateWeeklyBanned(t *testing.T) {
+	db, err := OpenDB("sqlite3", filepath.Join(t.TempDir(), "thronebot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// weekly_banned held IDs or names, depending on the version of the bot that wrote them
+	for _, q := range []string{
+		"CREATE TABLE weekly_banned (chars INTEGER, crowns TEXT, wep TEXT);",
+		"INSERT INTO weekly_banned(chars, crowns, wep) VALUES (5, 'crown of death', NULL);",
+		"INSERT INTO weekly_banned(chars, crowns, wep) VALUES (NULL, '11', 'gl');",
+		"INSERT INTO weekly_banned(chars, crowns, wep) VALUES (NULL, NULL, 'no such gun');",
+	} {
+		if _, err = db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	bans, err := NewSQLStore(db).Bans(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[banKey]bool)
+	for _, b := range bans {
+		got[banKey{b.Kind, b.ItemID}] = true
+	}
+
+	want := []banKey{
+		{BanChar, Chars.NameToID("plant")},
+		{BanCrown, Crowns.NameToID("death")},
+		{BanCrown, Crowns.NameToID("curses")},
+		{BanWeapon, Weapons.NameToID("grenade launcher")},
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("got %d bans, want %d: %v", len(got), len(want), bans)
+	}
+	for _, k := range want {
+		if !got[k] {
+			t.Errorf("%s %d wasn't migrated", k.Kind, k.ItemID)
+		}
+	}
+}
+
+func TestMigrateSuggestionIDs(t *testing.T) {
+	db, err := OpenDB("sqlite3", filepath.Join(t.TempDir(), "thronebot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Suggestions were identified by their rowid, which has gaps once suggestions are deleted
+	for _, q := range []string{
+		"CREATE TABLE weekly_suggestions (uid TEXT NOT NULL, char TEXT NOT NULL, skin INTEGER NOT NULL, weap TEXT NOT NULL, crown TEXT NOT NULL);",
+		"CREATE TABLE weekly_votes (suggestion_id INTEGER PRIMARY KEY, message_id TEXT UNIQUE, up INTEGER NOT NULL DEFAULT 0, down INTEGER NOT NULL DEFAULT 0);",
+		"INSERT INTO weekly_suggestions(uid, char, skin, weap, crown) VALUES ('u1', 'fish', 0, 'gl', 'death'), ('u2', 'plant', 1, 'xbow', 'guns'), ('u3', 'eyes', 0, 'mg', 'none');",
+		"DELETE FROM weekly_suggestions WHERE rowid = 1;",
+		"INSERT INTO weekly_votes(suggestion_id, message_id, up) VALUES (3, 'm3', 4);",
+	} {
+		if _, err = db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec("VACUUM;"); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewSQLStore(db)
+	sg, err := store.Suggestion(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sg == nil || sg.UserID != "u3" || sg.Up != 4 {
+		t.Fatalf("got suggestion 3 %+v, want u3's with 4 upvotes", sg)
+	}
+
+	// New suggestions never reuse the ID of an old one
+	id, err := store.InsertSuggestion("u4", &Build{Char: "robot", Weap: "gl", Crown: "death"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id <= 3 {
+		t.Errorf("got ID %d for a new suggestion, want more than 3", id)
+	}
+}
@@ -0,0 +1,459 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Krognol/thronebot/internal/router"
+	"github.com/bwmarrin/discordgo"
+)
+
+// GuildSettings are the settings of a single Discord server
+type GuildSettings struct {
+	GuildID           string
+	Prefix            string
+	StaffRole         string
+	StaffChannel      string
+	SuggestionChannel string
+	VotingChannel     string
+	ArchiveChannel    string
+	SuggestionLimit   int
+	WeeklyCooldown    int
+}
+
+// settingKind is the type of a setting's value
+type settingKind int
+
+const (
+	settingString settingKind = iota
+	settingChannel
+	settingRole
+	settingInt
+	settingPrefix
+)
+
+type setting struct {
+	kind settingKind
+	// field returns a pointer to the setting in gs, for reading and writing
+	field func(gs *GuildSettings) interface{}
+}
+
+// settingDefs maps setting names, which are also their column names, to their definitions
+var settingDefs = map[string]setting{
+	"prefix":             {settingPrefix, func(gs *GuildSettings) interface{} { return &gs.Prefix }},
+	"staff_role":         {settingRole, func(gs *GuildSettings) interface{} { return &gs.StaffRole }},
+	"staff_channel":      {settingChannel, func(gs *GuildSettings) interface{} { return &gs.StaffChannel }},
+	"suggestion_channel": {settingChannel, func(gs *GuildSettings) interface{} { return &gs.SuggestionChannel }},
+	"voting_channel":     {settingChannel, func(gs *GuildSettings) interface{} { return &gs.VotingChannel }},
+	"archive_channel":    {settingChannel, func(gs *GuildSettings) interface{} { return &gs.ArchiveChannel }},
+	"suggestion_limit":   {settingInt, func(gs *GuildSettings) interface{} { return &gs.SuggestionLimit }},
+	"weekly_cooldown":    {settingInt, func(gs *GuildSettings) interface{} { return &gs.WeeklyCooldown }},
+}
+
+// zeroMeans describes what 0 means for the number settings
+var zeroMeans = map[string]string{
+	"suggestion_limit": "disables suggestions",
+	"weekly_cooldown":  "lets builds repeat right away",
+}
+
+// SettingNames returns the names of every guild setting in alphabetical order
+func SettingNames() []string {
+	names := make([]string, 0, len(settingDefs))
+	for name := range settingDefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Settings stores per-guild settings in the database. Settings which were never set use the defaults.
+type Settings struct {
+	DB *DB
+
+	mu       sync.RWMutex
+	defaults GuildSettings
+}
+
+// NewSettings returns a new settings service
+func NewSettings(db *DB, defaults GuildSettings) *Settings {
+	return &Settings{DB: db, defaults: defaults}
+}
+
+// Defaults returns the settings used by guilds which haven't changed them
+func (s *Settings) Defaults() GuildSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaults
+}
+
+// SetDefaults replaces the settings used by guilds which haven't changed them
+func (s *Settings) SetDefaults(defaults GuildSettings) {
+	s.mu.Lock()
+	s.defaults = defaults
+	s.mu.Unlock()
+}
+
+// Get returns the settings of a guild
+func (s *Settings) Get(guildID string) (*GuildSettings, error) {
+	names := SettingNames()
+	vals := make([]interface{}, len(names))
+	for i, name := range names {
+		if settingDefs[name].kind == settingInt {
+			vals[i] = new(sql.NullInt64)
+		} else {
+			vals[i] = new(sql.NullString)
+		}
+	}
+
+	gs := s.Defaults()
+	gs.GuildID = guildID
+
+	err := s.DB.QueryRow("SELECT "+strings.Join(names, ", ")+" FROM guild_settings WHERE guild_id = ?;", guildID).Scan(vals...)
+	if err == sql.ErrNoRows {
+		return &gs, nil
+	}
+
+	if err != nil {
+		log.Println("settings: failed to query guild settings:", err)
+		return nil, err
+	}
+
+	for i, name := range names {
+		switch v := vals[i].(type) {
+		case *sql.NullInt64:
+			if v.Valid {
+				*settingDefs[name].field(&gs).(*int) = int(v.Int64)
+			}
+		case *sql.NullString:
+			if v.Valid {
+				*settingDefs[name].field(&gs).(*string) = v.String
+			}
+		}
+	}
+
+	return &gs, nil
+}
+
+// All returns the settings of every guild that has changed a setting
+func (s *Settings) All() ([]*GuildSettings, error) {
+	rows, err := s.DB.Query("SELECT guild_id FROM guild_settings;")
+	if err != nil {
+		log.Println("settings: failed to query guilds:", err)
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	res := make([]*GuildSettings, 0, len(ids))
+	for _, id := range ids {
+		gs, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, gs)
+	}
+	return res, nil
+}
+
+// maxPrefixLen is the length of the longest command prefix, in characters
+const maxPrefixLen = 16
+
+// isReset reports whether value resets a setting to its default
+func isReset(value string) bool {
+	return value == "default" || value == "none"
+}
+
+// parseSetting parses value for the setting name. A nil result means the setting is reset.
+func parseSetting(name, value string) (interface{}, error) {
+	def, ok := settingDefs[name]
+	if !ok {
+		return nil, errors.New("unknown setting `" + name + "`. Valid settings are: " + strings.Join(SettingNames(), ", "))
+	}
+
+	if isReset(value) {
+		return nil, nil
+	}
+
+	switch def.kind {
+	case settingChannel:
+		return strings.TrimSuffix(strings.TrimPrefix(value, "<#"), ">"), nil
+	case settingRole:
+		return strings.TrimSuffix(strings.TrimPrefix(value, "<@&"), ">"), nil
+	case settingInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, errors.New("`" + name + "` must be a non-negative number. 0 " + zeroMeans[name] + ".")
+		}
+		return n, nil
+	case settingPrefix:
+		if strings.ContainsAny(value, " \t\n`") || utf8.RuneCountInString(value) > maxPrefixLen {
+			return nil, errors.New("`" + name + "` must be at most " + strconv.Itoa(maxPrefixLen) +
+				" characters without spaces or backticks")
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// apply stores val as the setting name of gs, or copies it from defaults if val is nil
+func apply(gs, defaults *GuildSettings, name string, val interface{}) {
+	def := settingDefs[name]
+	switch f := def.field(gs).(type) {
+	case *int:
+		if val == nil {
+			*f = *def.field(defaults).(*int)
+		} else {
+			*f = val.(int)
+		}
+	case *string:
+		if val == nil {
+			*f = *def.field(defaults).(*string)
+		} else {
+			*f = val.(string)
+		}
+	}
+}
+
+// ValidateSetting checks that the channel or role value refers to something in the guild.
+// Other kinds of settings are checked by Set.
+func ValidateSetting(ctx *router.Context, guildID, name, value string) error {
+	val, err := parseSetting(name, value)
+	if err != nil || val == nil {
+		return err
+	}
+
+	switch settingDefs[name].kind {
+	case settingChannel:
+		ch, err := ctx.Channel(val.(string))
+		if err != nil || ch.GuildID != guildID {
+			return errors.New("there's no channel `" + value + "` in this server")
+		}
+
+		if ch.Type != discordgo.ChannelTypeGuildText {
+			return errors.New("<#" + ch.ID + "> isn't a text channel")
+		}
+	case settingRole:
+		g, err := ctx.Guild(guildID)
+		if err != nil {
+			log.Println("settings: failed to retrieve guild:", err)
+			return errors.New("couldn't retrieve this server's roles")
+		}
+
+		for _, r := range g.Roles {
+			if r.ID == val.(string) {
+				return nil
+			}
+		}
+		return errors.New("there's no role `" + value + "` in this server")
+	}
+	return nil
+}
+
+// Set parses value and stores it as the setting name of a guild, recording the change in the audit log.
+// The values `default` and `none` reset the setting to its default.
+func (s *Settings) Set(guildID, name, value, changedBy string) error {
+	val, err := parseSetting(name, value)
+	if err != nil {
+		return err
+	}
+
+	old, err := s.Get(guildID)
+	if err != nil {
+		return err
+	}
+
+	defaults := s.Defaults()
+	updated := *old
+	apply(&updated, &defaults, name, val)
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		log.Println("settings: failed to begin transaction:", err)
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// name is one of the keys of settingDefs, so it's safe to use as a column name
+	_, err = tx.Exec(
+		"INSERT INTO guild_settings(guild_id, "+name+") VALUES(?, ?) ON CONFLICT(guild_id) DO UPDATE SET "+name+" = excluded."+name+";",
+		guildID, val,
+	)
+	if err != nil {
+		log.Println("settings: failed to store setting:", err)
+		return err
+	}
+
+	if err = insertAudit(tx, guildID, name, old.Value(name), updated.Value(name), changedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetDefault parses value and stores it as the default of the setting name, recording the change in the audit log.
+// It returns the new defaults so they can be saved to the config file.
+func (s *Settings) SetDefault(name, value, changedBy string) (GuildSettings, error) {
+	val, err := parseSetting(name, value)
+	if err != nil {
+		return GuildSettings{}, err
+	}
+
+	if val == nil {
+		return GuildSettings{}, errors.New("defaults can't be reset")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := s.defaults
+	apply(&updated, &s.defaults, name, val)
+
+	if err = insertAudit(s.DB, AuditGlobal, name, s.defaults.Value(name), updated.Value(name), changedBy); err != nil {
+		return GuildSettings{}, err
+	}
+
+	s.defaults = updated
+	return updated, nil
+}
+
+// AuditGlobal is the guild ID audit entries for changes to the defaults are recorded under
+const AuditGlobal = "global"
+
+// AuditEntry is a single change to a setting
+type AuditEntry struct {
+	GuildID   string
+	Setting   string
+	Old       string
+	New       string
+	ChangedBy string
+	ChangedAt time.Time
+}
+
+func insertAudit(db execer, guildID, name, oldVal, newVal, changedBy string) error {
+	_, err := db.Exec(
+		"INSERT INTO settings_audit(guild_id, setting, old_value, new_value, changed_by, changed_at) VALUES(?, ?, ?, ?, ?, ?);",
+		guildID, name, oldVal, newVal, changedBy, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		log.Println("settings: failed to insert audit entry:", err)
+		return err
+	}
+
+	log.Println("settings:", changedBy, "changed", name, "in", guildID, "from", oldVal, "to", newVal)
+	return nil
+}
+
+// GetAudit returns the n most recent setting changes of a guild, including changes to the defaults
+func (s *Settings) GetAudit(guildID string, n int) ([]*AuditEntry, error) {
+	rows, err := s.DB.Query(
+		"SELECT guild_id, setting, old_value, new_value, changed_by, changed_at FROM settings_audit WHERE guild_id IN (?, ?) ORDER BY id DESC LIMIT ?;",
+		guildID, AuditGlobal, n,
+	)
+	if err != nil {
+		log.Println("settings: failed to query audit log:", err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []*AuditEntry
+	for rows.Next() {
+		var (
+			e  AuditEntry
+			at string
+		)
+
+		if err = rows.Scan(&e.GuildID, &e.Setting, &e.Old, &e.New, &e.ChangedBy, &at); err != nil {
+			log.Println("settings: failed to scan audit entry:", err)
+			return nil, err
+		}
+
+		e.ChangedAt, _ = time.Parse(time.RFC3339, at)
+		res = append(res, &e)
+	}
+
+	return res, rows.Err()
+}
+
+// Value returns the setting name of gs formatted for display
+func (gs *GuildSettings) Value(name string) string {
+	def, ok := settingDefs[name]
+	if !ok {
+		return ""
+	}
+
+	switch v := def.field(gs).(type) {
+	case *int:
+		return strconv.Itoa(*v)
+	case *string:
+		if *v == "" {
+			return "not set"
+		}
+
+		switch def.kind {
+		case settingChannel:
+			return "<#" + *v + ">"
+		case settingRole:
+			return "<@&" + *v + ">"
+		}
+		return *v
+	}
+	return ""
+}
+
+// Embed renders gs as an embed with a field for every setting
+func (gs *GuildSettings) Embed(title string) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: title}
+	for _, name := range SettingNames() {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   name,
+			Value:  gs.Value(name),
+			Inline: true,
+		})
+	}
+	return embed
+}
+
+// Channels returns the distinct, non-empty values of a channel setting across every guild,
+// including the default
+func (s *Settings) Channels(name string) []string {
+	def, ok := settingDefs[name]
+	if !ok || def.kind != settingChannel {
+		return nil
+	}
+
+	all, err := s.All()
+	if err != nil {
+		return nil
+	}
+
+	defaults := s.Defaults()
+	all = append(all, &defaults)
+
+	var res []string
+	seen := make(map[string]bool)
+	for _, gs := range all {
+		if ch := *def.field(gs).(*string); ch != "" && !seen[ch] {
+			seen[ch] = true
+			res = append(res, ch)
+		}
+	}
+	return res
+}
@@ -0,0 +1,510 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStore is a WeeklyStore backed by an SQLite or PostgreSQL database
+type SQLStore struct {
+	DB *DB
+}
+
+// NewSQLStore returns a store using db, which must have been migrated with Migrate
+func NewSQLStore(db *DB) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+var _ WeeklyStore = (*SQLStore)(nil)
+
+// Ping checks the connection to the database
+func (s *SQLStore) Ping() error {
+	return s.DB.Ping()
+}
+
+// SuggestionCount returns how many suggestions the user has made this week
+func (s *SQLStore) SuggestionCount(uid string) (int, error) {
+	var count int
+	err := s.DB.QueryRow("SELECT count FROM user_suggestions WHERE id = ?;", uid).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("suggestionCount: %v", err)
+	}
+	return count, nil
+}
+
+// InsertSuggestion stores a suggestion, increments the user's suggestion count and returns the suggestion's ID
+func (s *SQLStore) InsertSuggestion(uid string, b *Build) (id int64, err error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("insertSuggestion: failed to begin Tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	id, err = tx.insertID(
+		`INSERT INTO weekly_suggestions(uid, "char", skin, weap, crown) VALUES(?, ?, ?, ?, ?)`,
+		"id", uid, b.Char, boolInt(b.Skin), b.Weap, b.Crown,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insertSuggestion: %v", err)
+	}
+
+	if len(b.Mutations) > 0 || b.Ultra != "" {
+		_, err = tx.Exec(
+			"INSERT INTO suggestion_mutations(suggestion_id, mutations, ultra) VALUES(?, ?, ?);",
+			id, b.JoinedMutations(), b.Ultra,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("insertSuggestion: failed to insert mutations: %v", err)
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO user_suggestions(id, count) VALUES(?, 1) ON CONFLICT(id) DO UPDATE SET count = user_suggestions.count + 1;", uid)
+	if err != nil {
+		return 0, fmt.Errorf("insertSuggestion: failed to update suggestion count: %v", err)
+	}
+
+	return id, tx.Commit()
+}
+
+// SetSuggestionMessage stores the ID of the voting message posted for a suggestion
+func (s *SQLStore) SetSuggestionMessage(id int64, messageID string) error {
+	_, err := s.DB.Exec("INSERT INTO weekly_votes(suggestion_id, message_id) VALUES(?, ?);", id, messageID)
+	if err != nil {
+		return fmt.Errorf("setSuggestionMessage: %v", err)
+	}
+	return nil
+}
+
+// UpdateVotes adds delta to the up or down vote count of the suggestion posted as messageID
+func (s *SQLStore) UpdateVotes(messageID string, up bool, delta int) error {
+	col := "down"
+	if up {
+		col = "up"
+	}
+
+	_, err := s.DB.Exec("UPDATE weekly_votes SET "+col+" = "+col+" + ? WHERE message_id = ?;", delta, messageID)
+	if err != nil {
+		return fmt.Errorf("updateVotes: %v", err)
+	}
+	return nil
+}
+
+// selectSuggestions selects suggestions in the order scanSuggestion expects
+const selectSuggestions = `SELECT s.id, s.uid, s."char", s.skin, s.weap, s.crown,
+		COALESCE(m.mutations, ''), COALESCE(m.ultra, ''), COALESCE(v.up, 0), COALESCE(v.down, 0)
+	FROM weekly_suggestions s
+	LEFT JOIN suggestion_mutations m ON m.suggestion_id = s.id
+	LEFT JOIN weekly_votes v ON v.suggestion_id = s.id`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSuggestion(row scanner) (*Suggestion, error) {
+	var (
+		s    = new(Suggestion)
+		muts string
+	)
+
+	err := row.Scan(&s.ID, &s.UserID, &s.Char, &s.Skin, &s.Weap, &s.Crown, &muts, &s.Ultra, &s.Up, &s.Down)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Mutations = SplitMutations(muts)
+	return s, nil
+}
+
+// orderSuggestions orders suggestions by their net votes, highest first
+const orderSuggestions = " ORDER BY COALESCE(v.up, 0) - COALESCE(v.down, 0) DESC, COALESCE(v.up, 0) DESC, s.id ASC;"
+
+// querySuggestions returns the suggestions selected by q
+func querySuggestions(db interface {
+	Query(q string, args ...interface{}) (*sql.Rows, error)
+}, q string) ([]*Suggestion, error) {
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []*Suggestion
+	for rows.Next() {
+		sg, err := scanSuggestion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		res = append(res, sg)
+	}
+
+	return res, rows.Err()
+}
+
+// Suggestions returns this week's suggestions ordered by their net votes, highest first
+func (s *SQLStore) Suggestions() ([]*Suggestion, error) {
+	res, err := querySuggestions(s.DB, selectSuggestions+orderSuggestions)
+	if err != nil {
+		return nil, fmt.Errorf("suggestions: %v", err)
+	}
+	return res, nil
+}
+
+// Suggestion returns the suggestion with the given ID, or nil if there is none
+func (s *SQLStore) Suggestion(id int64) (*Suggestion, error) {
+	sg, err := scanSuggestion(s.DB.QueryRow(selectSuggestions+" WHERE s.id = ?;", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("suggestion: %v", err)
+	}
+
+	return sg, nil
+}
+
+// CloseWeek archives this week's suggestions under week, clears them and their votes, resets every user's
+// suggestion count and records now as the time of the last weekly cycle. The winner is the suggestion
+// with the most net votes. It returns the archived suggestions ordered like Suggestions.
+func (s *SQLStore) CloseWeek(week string, now time.Time) ([]*Suggestion, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("closeWeek: failed to begin Tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	// Claim the week first, so only one of several instances sharing the database closes it
+	res, err := tx.Exec(
+		"INSERT INTO bot_state(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value WHERE bot_state.value < excluded.value;",
+		stateLastCycle, now.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("closeWeek: %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("closeWeek: %v", err)
+	} else if n == 0 {
+		return nil, ErrWeekClosed
+	}
+
+	suggestions, err := querySuggestions(tx, selectSuggestions+orderSuggestions)
+	if err != nil {
+		return nil, fmt.Errorf("closeWeek: %v", err)
+	}
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO suggestion_archive(week, suggestion_id, uid, "char", skin, weap, crown, mutations, ultra, up, down, winner)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("closeWeek: %v", err)
+	}
+
+	defer stmt.Close()
+
+	var (
+		ids          []interface{}
+		placeholders []string
+	)
+
+	for i, sg := range suggestions {
+		_, err = stmt.Exec(
+			week, sg.ID, sg.UserID, sg.Char, boolInt(sg.Skin), sg.Weap, sg.Crown,
+			sg.JoinedMutations(), sg.Ultra, sg.Up, sg.Down, boolInt(i == 0),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("closeWeek: failed to archive suggestion: %v", err)
+		}
+
+		ids = append(ids, sg.ID)
+		placeholders = append(placeholders, "?")
+	}
+
+	// Only the archived suggestions are deleted, ones suggested while the week was being closed count for the next week
+	if len(ids) > 0 {
+		in := "(" + strings.Join(placeholders, ", ") + ");"
+		for _, q := range []string{
+			"DELETE FROM weekly_suggestions WHERE id IN " + in,
+			"DELETE FROM weekly_votes WHERE suggestion_id IN " + in,
+			"DELETE FROM suggestion_mutations WHERE suggestion_id IN " + in,
+		} {
+			if _, err = tx.Exec(q, ids...); err != nil {
+				return nil, fmt.Errorf("closeWeek: %v", err)
+			}
+		}
+	}
+
+	if _, err = tx.Exec("UPDATE user_suggestions SET count = 0;"); err != nil {
+		return nil, fmt.Errorf("closeWeek: %v", err)
+	}
+
+	return suggestions, tx.Commit()
+}
+
+const stateLastCycle = "last_weekly_cycle"
+
+// LastCycle returns when the weekly cycle last ran, or the zero time if it never has
+func (s *SQLStore) LastCycle() (time.Time, error) {
+	var val string
+	err := s.DB.QueryRow("SELECT value FROM bot_state WHERE key = ?;", stateLastCycle).Scan(&val)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("lastCycle: %v", err)
+	}
+
+	return time.Parse(time.RFC3339, val)
+}
+
+// SetLastCycle records when the weekly cycle last ran
+func (s *SQLStore) SetLastCycle(t time.Time) error {
+	if err := setState(s.DB, stateLastCycle, t.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("setLastCycle: %v", err)
+	}
+	return nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func setState(db execer, key, value string) error {
+	_, err := db.Exec("INSERT INTO bot_state(key, value) VALUES(?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value;", key, value)
+	return err
+}
+
+const banColumns = "kind, item_id, reason, banned_by, created_at, expires_at"
+
+func scanBan(row scanner) (*Ban, error) {
+	var (
+		b             = new(Ban)
+		kind, created string
+		expires       sql.NullString
+		err           error
+	)
+
+	if err = row.Scan(&kind, &b.ItemID, &b.Reason, &b.BannedBy, &created, &expires); err != nil {
+		return nil, err
+	}
+
+	b.Kind = BanKind(kind)
+	if b.Created, err = time.Parse(time.RFC3339, created); err != nil {
+		return nil, err
+	}
+
+	if expires.Valid {
+		if b.Expires, err = time.Parse(time.RFC3339, expires.String); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func (s *SQLStore) queryBans(q string, args ...interface{}) ([]*Ban, error) {
+	rows, err := s.DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []*Ban
+	for rows.Next() {
+		b, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+
+	return res, rows.Err()
+}
+
+// AddBan bans an item for the weekly. Banning an already banned item replaces the old ban.
+func (s *SQLStore) AddBan(b *Ban) error {
+	var exp interface{}
+	if !b.Expires.IsZero() {
+		exp = b.Expires.UTC().Format(time.RFC3339)
+	}
+
+	_, err := s.DB.Exec(
+		`INSERT INTO weekly_bans(`+banColumns+`) VALUES(?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kind, item_id) DO UPDATE SET
+			reason = excluded.reason,
+			banned_by = excluded.banned_by,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at;`,
+		string(b.Kind), b.ItemID, b.Reason, b.BannedBy, b.Created.UTC().Format(time.RFC3339), exp,
+	)
+	if err != nil {
+		return fmt.Errorf("addBan: %v", err)
+	}
+	return nil
+}
+
+// DelBan removes an item from the banned list. It reports whether the item was banned.
+func (s *SQLStore) DelBan(kind BanKind, itemID int) (bool, error) {
+	res, err := s.DB.Exec("DELETE FROM weekly_bans WHERE kind = ? AND item_id = ?;", string(kind), itemID)
+	if err != nil {
+		return false, fmt.Errorf("delBan: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Bans returns every ban which is active at now, ordered by kind and item ID
+func (s *SQLStore) Bans(now time.Time) ([]*Ban, error) {
+	bans, err := s.queryBans(
+		"SELECT "+banColumns+" FROM weekly_bans WHERE expires_at IS NULL OR expires_at > ? ORDER BY kind, item_id;",
+		now.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("bans: %v", err)
+	}
+	return bans, nil
+}
+
+// IsBanned checks if one or more items of the build are banned at now
+func (s *SQLStore) IsBanned(b *Build, now time.Time) (bool, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	for _, k := range banKeys(b) {
+		conds = append(conds, "(kind = ? AND item_id = ?)")
+		args = append(args, string(k.Kind), k.ItemID)
+	}
+
+	var n int
+	err := s.DB.QueryRow(
+		"SELECT COUNT(*) FROM weekly_bans WHERE ("+strings.Join(conds, " OR ")+") AND (expires_at IS NULL OR expires_at > ?);",
+		append(args, now.UTC().Format(time.RFC3339))...,
+	).Scan(&n)
+
+	if err != nil {
+		return false, fmt.Errorf("isBanned: %v", err)
+	}
+
+	return n > 0, nil
+}
+
+// PruneExpiredBans removes every ban which expired at or before now and returns them
+func (s *SQLStore) PruneExpiredBans(now time.Time) ([]*Ban, error) {
+	ts := now.UTC().Format(time.RFC3339)
+
+	// Deleting and returning in one statement keeps several instances from announcing the same unbans
+	if s.DB.Dialect.returning {
+		bans, err := s.queryBans("DELETE FROM weekly_bans WHERE expires_at <= ? RETURNING "+banColumns+";", ts)
+		if err != nil {
+			return nil, fmt.Errorf("pruneExpiredBans: %v", err)
+		}
+		return bans, nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("pruneExpiredBans: failed to begin Tx: %v", err)
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT "+banColumns+" FROM weekly_bans WHERE expires_at <= ?;", ts)
+	if err != nil {
+		return nil, fmt.Errorf("pruneExpiredBans: %v", err)
+	}
+
+	var res []*Ban
+	for rows.Next() {
+		b, err := scanBan(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("pruneExpiredBans: failed to scan row: %v", err)
+		}
+		res = append(res, b)
+	}
+	rows.Close()
+
+	if _, err = tx.Exec("DELETE FROM weekly_bans WHERE expires_at <= ?;", ts); err != nil {
+		return nil, fmt.Errorf("pruneExpiredBans: %v", err)
+	}
+
+	return res, tx.Commit()
+}
+
+// InsertHistory records a weekly as set by the user with ID setBy
+func (s *SQLStore) InsertHistory(b *Build, setBy string, at time.Time) error {
+	_, err := s.DB.Exec(
+		`INSERT INTO weekly_history("char", skin, weap, crown, mutations, ultra, set_by, set_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?);`,
+		b.Char, boolInt(b.Skin), b.Weap, b.Crown, b.JoinedMutations(), b.Ultra, setBy, at.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("insertHistory: %v", err)
+	}
+	return nil
+}
+
+// History returns the n most recently set weeklies, newest first
+func (s *SQLStore) History(n int) ([]*HistoryEntry, error) {
+	rows, err := s.DB.Query(`SELECT "char", skin, weap, crown, mutations, ultra, set_by, set_at FROM weekly_history ORDER BY id DESC LIMIT ?;`, n)
+	if err != nil {
+		return nil, fmt.Errorf("history: %v", err)
+	}
+
+	defer rows.Close()
+
+	var res []*HistoryEntry
+	for rows.Next() {
+		var (
+			e           = new(HistoryEntry)
+			muts, setAt string
+		)
+
+		err = rows.Scan(&e.Char, &e.Skin, &e.Weap, &e.Crown, &muts, &e.Ultra, &e.SetBy, &setAt)
+		if err != nil {
+			return nil, fmt.Errorf("history: failed to scan row: %v", err)
+		}
+
+		e.Mutations = SplitMutations(muts)
+		if e.SetAt, err = time.Parse(time.RFC3339, setAt); err != nil {
+			return nil, fmt.Errorf("history: invalid timestamp: %v", err)
+		}
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+// LastPlayed returns when a weekly with the same character, weapon and crown as b was last set.
+// The returned time is zero if it has never been played.
+func (s *SQLStore) LastPlayed(b *Build) (time.Time, error) {
+	var setAt string
+	err := s.DB.QueryRow(
+		`SELECT set_at FROM weekly_history WHERE "char" = ? AND weap = ? AND crown = ? ORDER BY id DESC LIMIT 1;`,
+		b.Char, b.Weap, b.Crown,
+	).Scan(&setAt)
+
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("lastPlayed: %v", err)
+	}
+
+	return time.Parse(time.RFC3339, setAt)
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrWeekClosed is returned by CloseWeek when the week was already closed, usually by another
+// instance of the bot sharing the database
+var ErrWeekClosed = errors.New("the week has already been closed")
+
+// WeeklyStore stores everything about the weekly: suggestions and their votes, per-user suggestion counts,
+// bans and the history of set weeklies. Implementations must be safe for concurrent use.
+type WeeklyStore interface {
+	// SuggestionCount returns how many suggestions the user has made this week
+	SuggestionCount(uid string) (int, error)
+	// InsertSuggestion stores a suggestion, increments the user's suggestion count and returns the suggestion's ID
+	InsertSuggestion(uid string, b *Build) (int64, error)
+	// SetSuggestionMessage stores the ID of the voting message posted for a suggestion
+	SetSuggestionMessage(id int64, messageID string) error
+	// UpdateVotes adds delta to the up or down vote count of the suggestion posted as messageID
+	UpdateVotes(messageID string, up bool, delta int) error
+	// Suggestions returns this week's suggestions ordered by their net votes, highest first
+	Suggestions() ([]*Suggestion, error)
+	// Suggestion returns the suggestion with the given ID, or nil if there is none
+	Suggestion(id int64) (*Suggestion, error)
+	// CloseWeek archives this week's suggestions under week with the first one as the winner, clears them
+	// and their votes, resets every user's suggestion count and records now as the time of the last weekly cycle.
+	// It returns the archived suggestions ordered like Suggestions, or ErrWeekClosed if the last weekly cycle
+	// is already at or after now.
+	CloseWeek(week string, now time.Time) ([]*Suggestion, error)
+	// LastCycle returns when the weekly cycle last ran, or the zero time if it never has
+	LastCycle() (time.Time, error)
+	// SetLastCycle records when the weekly cycle last ran
+	SetLastCycle(t time.Time) error
+
+	// AddBan bans an item for the weekly. Banning an already banned item replaces the old ban.
+	AddBan(b *Ban) error
+	// DelBan removes an item from the banned list. It reports whether the item was banned.
+	DelBan(kind BanKind, itemID int) (bool, error)
+	// Bans returns every ban which is active at now, ordered by kind and item ID
+	Bans(now time.Time) ([]*Ban, error)
+	// IsBanned checks if one or more items of the build are banned at now
+	IsBanned(b *Build, now time.Time) (bool, error)
+	// PruneExpiredBans removes every ban which expired at or before now and returns them
+	PruneExpiredBans(now time.Time) ([]*Ban, error)
+
+	// InsertHistory records a weekly as set by the user with ID setBy
+	InsertHistory(b *Build, setBy string, at time.Time) error
+	// History returns the n most recently set weeklies, newest first
+	History(n int) ([]*HistoryEntry, error)
+	// LastPlayed returns when a weekly with the same character, weapon and crown as b was last set.
+	// The returned time is zero if it has never been played.
+	LastPlayed(b *Build) (time.Time, error)
+
+	// Ping checks that the store is reachable
+	Ping() error
+}
+
+// Suggestion is a weekly suggestion together with its vote counts
+type Suggestion struct {
+	ID     int64
+	UserID string
+	Build
+	Up   int
+	Down int
+}
+
+// Score is the suggestion's net vote count
+func (s *Suggestion) Score() int { return s.Up - s.Down }
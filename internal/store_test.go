@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// storeTables are emptied before the store tests run on PostgreSQL
+var storeTables = []string{
+	"weekly_suggestions", "user_suggestions", "weekly_bans", "weekly_votes", "suggestion_mutations",
+	"suggestion_archive", "weekly_history", "bot_state",
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLStore(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := OpenDB("sqlite3", filepath.Join(t.TempDir(), "thronebot.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err = Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+		testStore(t, NewSQLStore(db))
+	})
+
+	// The database is emptied, so it must be one used only for testing
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("THRONEBOT_TEST_POSTGRES")
+		if dsn == "" {
+			t.Skip("THRONEBOT_TEST_POSTGRES isn't set")
+		}
+
+		db, err := OpenDB("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err = Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, table := range storeTables {
+			if _, err = db.Exec("DELETE FROM " + table + ";"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testStore(t, NewSQLStore(db))
+	})
+}
+
+// testStore checks the behaviour every WeeklyStore shares. store must be empty.
+func testStore(t *testing.T, store WeeklyStore) {
+	t.Helper()
+
+	if err := store.Ping(); err != nil {
+		t.Fatal("Ping:", err)
+	}
+
+	t.Run("suggestions", func(t *testing.T) { testStoreSuggestions(t, store) })
+	t.Run("bans", func(t *testing.T) { testStoreBans(t, store) })
+	t.Run("history", func(t *testing.T) { testStoreHistory(t, store) })
+}
+
+func testStoreSuggestions(t *testing.T, store WeeklyStore) {
+	plain := &Build{Char: "crystal", Skin: true, Weap: "revolver", Crown: "life"}
+	mutated := &Build{Char: "fish", Weap: "grenade launcher", Crown: "death", Mutations: []string{"rhino skin", "extra feet"}, Ultra: "confiscate"}
+
+	first, err := store.InsertSuggestion("u1", plain)
+	if err != nil {
+		t.Fatal("InsertSuggestion:", err)
+	}
+
+	second, err := store.InsertSuggestion("u1", mutated)
+	if err != nil {
+		t.Fatal("InsertSuggestion:", err)
+	}
+
+	if n, err := store.SuggestionCount("u1"); err != nil || n != 2 {
+		t.Errorf("SuggestionCount(u1) = %d, %v, want 2", n, err)
+	}
+
+	s, err := store.Suggestion(second)
+	if err != nil {
+		t.Fatal("Suggestion:", err)
+	}
+	if s == nil || s.UserID != "u1" || s.Build.String() != mutated.String() {
+		t.Errorf("Suggestion(%d) = %+v, want %s by u1", second, s, mutated)
+	}
+
+	if s, err = store.Suggestion(second + 100); err != nil || s != nil {
+		t.Errorf("Suggestion of a missing ID = %+v, %v, want nil", s, err)
+	}
+
+	if err = store.SetSuggestionMessage(first, "msg1"); err != nil {
+		t.Fatal("SetSuggestionMessage:", err)
+	}
+	if err = store.SetSuggestionMessage(second, "msg2"); err != nil {
+		t.Fatal("SetSuggestionMessage:", err)
+	}
+
+	// The second suggestion wins with 2 - 0 against 1 - 1
+	for _, v := range []struct {
+		msg string
+		up  bool
+	}{{"msg1", true}, {"msg1", false}, {"msg2", true}, {"msg2", true}} {
+		if err = store.UpdateVotes(v.msg, v.up, 1); err != nil {
+			t.Fatal("UpdateVotes:", err)
+		}
+	}
+
+	suggestions, err := store.Suggestions()
+	if err != nil {
+		t.Fatal("Suggestions:", err)
+	}
+	if len(suggestions) != 2 || suggestions[0].ID != second || suggestions[0].Up != 2 || suggestions[1].Up != 1 || suggestions[1].Down != 1 {
+		t.Fatalf("Suggestions = %+v, want #%d with 2 up first and #%d with 1 up and 1 down", suggestions, second, first)
+	}
+
+	now := time.Now()
+	closed, err := store.CloseWeek("2026-W01", now)
+	if err != nil {
+		t.Fatal("CloseWeek:", err)
+	}
+	if len(closed) != 2 || closed[0].ID != second || closed[1].ID != first {
+		t.Errorf("CloseWeek archived %+v, want #%d then #%d", closed, second, first)
+	}
+
+	if _, err = store.CloseWeek("2026-W01", now); err != ErrWeekClosed {
+		t.Errorf("closing the week again returned %v, want ErrWeekClosed", err)
+	}
+
+	if suggestions, err = store.Suggestions(); err != nil || len(suggestions) != 0 {
+		t.Errorf("Suggestions after CloseWeek = %+v, %v, want none", suggestions, err)
+	}
+	if n, err := store.SuggestionCount("u1"); err != nil || n != 0 {
+		t.Errorf("SuggestionCount(u1) after CloseWeek = %d, %v, want 0", n, err)
+	}
+}
+
+func testStoreBans(t *testing.T, store WeeklyStore) {
+	now := time.Now().UTC().Truncate(time.Second)
+	death, blood := Crowns.NameToID("death"), Crowns.NameToID("blood")
+
+	for _, b := range []*Ban{
+		{Kind: BanCrown, ItemID: death, Reason: "too easy", BannedBy: "u1", Created: now},
+		{Kind: BanCrown, ItemID: blood, BannedBy: "u1", Created: now.Add(-48 * time.Hour), Expires: now.Add(-time.Hour)},
+	} {
+		if err := store.AddBan(b); err != nil {
+			t.Fatal("AddBan:", err)
+		}
+	}
+
+	bans, err := store.Bans(now)
+	if err != nil {
+		t.Fatal("Bans:", err)
+	}
+	if len(bans) != 1 || bans[0].ItemID != death || bans[0].Reason != "too easy" || !bans[0].Expires.IsZero() {
+		t.Errorf("Bans = %+v, want only the permanent ban of crown %d", bans, death)
+	}
+
+	for crown, want := range map[string]bool{"death": true, "blood": false, "life": false} {
+		b := &Build{Char: "fish", Weap: "revolver", Crown: crown}
+		if banned, err := store.IsBanned(b, now); err != nil || banned != want {
+			t.Errorf("IsBanned(%s) = %v, %v, want %v", b, banned, err, want)
+		}
+	}
+
+	pruned, err := store.PruneExpiredBans(now)
+	if err != nil {
+		t.Fatal("PruneExpiredBans:", err)
+	}
+	if len(pruned) != 1 || pruned[0].ItemID != blood {
+		t.Errorf("PruneExpiredBans = %+v, want the ban of crown %d", pruned, blood)
+	}
+
+	if ok, err := store.DelBan(BanCrown, death); err != nil || !ok {
+		t.Errorf("DelBan = %v, %v, want true", ok, err)
+	}
+	if ok, err := store.DelBan(BanCrown, death); err != nil || ok {
+		t.Errorf("DelBan of a missing ban = %v, %v, want false", ok, err)
+	}
+}
+
+func testStoreHistory(t *testing.T, store WeeklyStore) {
+	now := time.Now().UTC().Truncate(time.Second)
+	older := &Build{Char: "plant", Weap: "revolver", Crown: "none"}
+	newer := &Build{Char: "rogue", Weap: "revolver", Crown: "luck"}
+
+	if err := store.InsertHistory(older, "u1", now.Add(-7*24*time.Hour)); err != nil {
+		t.Fatal("InsertHistory:", err)
+	}
+	if err := store.InsertHistory(newer, "u2", now); err != nil {
+		t.Fatal("InsertHistory:", err)
+	}
+
+	history, err := store.History(1)
+	if err != nil {
+		t.Fatal("History:", err)
+	}
+	if len(history) != 1 || history[0].Build.String() != newer.String() || history[0].SetBy != "u2" {
+		t.Errorf("History(1) = %+v, want %s set by u2", history, newer)
+	}
+
+	// Skins and mutations don't count as a different weekly
+	last, err := store.LastPlayed(&Build{Char: "plant", Skin: true, Weap: "revolver", Crown: "none", Ultra: "trapper"})
+	if err != nil {
+		t.Fatal("LastPlayed:", err)
+	}
+	if !last.Equal(now.Add(-7 * 24 * time.Hour)) {
+		t.Errorf("LastPlayed = %v, want %v", last, now.Add(-7*24*time.Hour))
+	}
+
+	if last, err = store.LastPlayed(&Build{Char: "horror", Weap: "revolver", Crown: "none"}); err != nil || !last.IsZero() {
+		t.Errorf("LastPlayed of a new build = %v, %v, want zero", last, err)
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Reactions used for voting on weekly suggestions
+const (
+	VoteUp   = "👍"
+	VoteDown = "👎"
+)
+
+// PostSuggestion posts a suggestion embed to the voting channel and seeds it with the vote reactions
+func PostSuggestion(s *discordgo.Session, channelID string, id int64, author *discordgo.User, b *Build) (*discordgo.Message, error) {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprint("Weekly suggestion #", id),
+		Color: 0xf5b700,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Character", Value: Chars.Display(b.Char), Inline: true},
+			{Name: "Skin", Value: b.SkinName(), Inline: true},
+			{Name: "Weapon", Value: Weapons.Display(b.Weap), Inline: true},
+			{Name: "Crown", Value: Crowns.Display(b.Crown), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Suggested by " + author.Username,
+		},
+	}
+
+	if len(b.Mutations) > 0 {
+		muts := make([]string, len(b.Mutations))
+		for i, mut := range b.Mutations {
+			muts[i] = Mutations.Display(mut)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Mutations", Value: strings.Join(muts, ", ")})
+	}
+
+	if b.Ultra != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Ultra mutation", Value: Ultras.Display(b.Ultra)})
+	}
+
+	msg, err := s.ChannelMessageSendEmbed(channelID, embed)
+	if err != nil {
+		log.Println("postSuggestion: failed to send embed:", err)
+		return nil, err
+	}
+
+	for _, emoji := range []string{VoteUp, VoteDown} {
+		if err = s.MessageReactionAdd(channelID, msg.ID, emoji); err != nil {
+			log.Println("postSuggestion: failed to add reaction:", err)
+			return msg, err
+		}
+	}
+
+	return msg, nil
+}
+
+// VoteAddHandler returns a discordgo handler which counts votes on posted suggestions
+func VoteAddHandler(store WeeklyStore) func(*discordgo.Session, *discordgo.MessageReactionAdd) {
+	return func(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		countVote(s, store, r.MessageReaction, 1)
+	}
+}
+
+// VoteRemoveHandler returns a discordgo handler which removes retracted votes on posted suggestions
+func VoteRemoveHandler(store WeeklyStore) func(*discordgo.Session, *discordgo.MessageReactionRemove) {
+	return func(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+		countVote(s, store, r.MessageReaction, -1)
+	}
+}
+
+func countVote(s *discordgo.Session, store WeeklyStore, r *discordgo.MessageReaction, delta int) {
+	// The bot's own seed reactions don't count
+	if s.State.User != nil && r.UserID == s.State.User.ID {
+		return
+	}
+
+	if r.Emoji.Name != VoteUp && r.Emoji.Name != VoteDown {
+		return
+	}
+
+	if err := store.UpdateVotes(r.MessageID, r.Emoji.Name == VoteUp, delta); err != nil {
+		log.Println("countVote:", err)
+	}
+}
@@ -1,55 +1,49 @@
 package main
 
 import (
-	"database/sql"
 	"database/sql/driver"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Krognol/tbapi"
 	"github.com/Krognol/thronebot/internal"
 	"github.com/Krognol/thronebot/internal/router"
 	"github.com/bwmarrin/discordgo"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-type config struct {
-	ArchiveRepo      string `json:"archive_repo"`
-	DatabasePath     string `json:"database_path"`
-	LogPath          string `json:"log_path"`
-	WeeklySuggestion string `json:"weekly_suggestion"`
-	WeeklyVoting     string `json:"weekly_voting"`
-	Staff            string `json:"staff"`
-}
-
 var (
-	tbAPIKey      = flag.String("tb", "", "Thronebot API key")
-	discordBotKey = flag.String("t", "", "Discord bot key")
-	githubAPIKey  = flag.String("git", "", "Github API key. For archiving of pins")
-	configPath    = flag.String("cfg", "config.json", "Path to config file.")
+	tbAPIKey       = flag.String("tb", "", "Thronebot API key. Prefer $THRONEBOT_THRONEBUTT_KEY or -secrets")
+	discordBotKey  = flag.String("t", "", "Discord bot key. Prefer $THRONEBOT_DISCORD_TOKEN or -secrets")
+	githubAPIKey   = flag.String("git", "", "Github API key. For archiving of pins. Prefer $THRONEBOT_GITHUB_KEY or -secrets")
+	configPath     = flag.String("cfg", "config.json", "Path to config file.")
+	secretsPath    = flag.String("secrets", "", "Path to a JSON file with the discord_token, thronebutt_key and github_key secrets.")
+	migrateOnly    = flag.Bool("migrate", false, "Apply database migrations and exit.")
+	restorePath    = flag.String("restore", "", "Replace the SQLite database with a backup and exit. The bot must not be running.")
+	reloadInterval = flag.Duration("reload", 10*time.Second, "How often to check the config file for changes. 0 only reloads on SIGHUP.")
 )
 
 func main() {
-	cfg := new(config)
-	func() {
-		f, err := os.Open(*configPath)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
+	flag.Parse()
 
-		err = json.NewDecoder(f).Decode(cfg)
-		if err != nil {
-			panic(err)
-		}
-	}()
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	sec, err := loadSecrets(*secretsPath)
+	if err != nil {
+		panic(err)
+	}
 
 	if cfg.LogPath == "" {
 		log.SetOutput(os.Stdout)
@@ -63,22 +57,57 @@ func main() {
 		defer f.Close()
 	}
 
-	if *discordBotKey == "" {
-		log.Fatal("Discord bot key can't be nil:", flag.ErrHelp)
+	if cfg.GameDataPath != "" {
+		if err := internal.LoadGameData(cfg.GameDataPath); err != nil {
+			log.Fatal("failed to load game data: ", err)
+		}
+		log.Println("loaded game data for patch", internal.Patch, "from", cfg.GameDataPath)
 	}
 
-	if *tbAPIKey == "" {
-		log.Fatal("Missing Thronebutt API key.")
+	dialect, err := internal.DialectOf(cfg.DatabaseDriver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *restorePath != "" {
+		if dialect != internal.SQLite {
+			log.Fatal("-restore only supports SQLite databases, use your database's own tools for ", dialect.Name)
+		}
+
+		if err = internal.Restore(*restorePath, cfg.DatabasePath); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Restored", cfg.DatabasePath, "from", *restorePath)
+		return
 	}
 
-	db, err := sql.Open("sqlite3", cfg.DatabasePath)
+	db, err := internal.OpenDB(cfg.DatabaseDriver, cfg.DatabasePath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	defer db.Close()
 
-	ses, err := discordgo.New(*discordBotKey)
+	applied, err := internal.Migrate(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *migrateOnly {
+		version, _ := internal.SchemaVersion(db)
+		fmt.Println("Applied", applied, "migrations. Database is at schema version", version)
+		return
+	}
+
+	if sec.DiscordToken == "" {
+		log.Fatal("Discord bot key can't be nil:", flag.ErrHelp)
+	}
+
+	if sec.ThronebuttKey == "" {
+		log.Fatal("Missing Thronebutt API key.")
+	}
+
+	ses, err := discordgo.New(sec.DiscordToken)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -86,129 +115,444 @@ func main() {
 	defer ses.Close()
 
 	bot := internal.NewBot(ses, db, router.NewRoute())
+	bot.Settings = internal.NewSettings(db, cfg.guildDefaults())
+
+	setPermissions := func(cfg *config) {
+		perms := cfg.permissions()
+		perms.GuildStaffRole = func(guildID string) string {
+			gs, err := bot.Settings.Get(guildID)
+			if err != nil {
+				return ""
+			}
+			return gs.StaffRole
+		}
+		internal.SetPermissions(perms)
+	}
+	setPermissions(cfg)
+
+	// Commands start with the server's prefix, or the default prefix so a forgotten prefix can be looked up
+	prefixes := router.PrefixFunc(func(guildID string) []string {
+		def := bot.Settings.Defaults().Prefix
+		if guildID == "" {
+			return []string{def}
+		}
 
-	tbClient := tbapi.New(*tbAPIKey)
+		gs, err := bot.Settings.Get(guildID)
+		if err != nil || strings.EqualFold(gs.Prefix, def) {
+			return []string{def}
+		}
+		return []string{gs.Prefix, def}
+	})
+
+	tbClient := tbapi.New(sec.ThronebuttKey)
 	// Commands
-	bot.Route.On("config", func(ctx *router.Context) {
-		ctx.Reply(
-			"Current config settings\n  Staff:", cfg.Staff,
-			"\n  Weekly voting:", cfg.WeeklyVoting,
-			"\n  Weekly suggestion:", cfg.WeeklySuggestion,
-		)
-	}).On("set", cfgSetHandler(cfg))
+	bot.Route.On("help", bot.Route.HelpHandler(prefixes)).
+		Desc("Print the available commands, or help for a single command.").
+		Args(&router.Arg{Name: "command", Desc: "The command to describe, ex. `weekly ban`", Kind: router.ArgRest})
+
+	bot.Route.Group(func(r *router.Route) {
+		r.Require(internal.LevelStaff.Permission())
+		config := r.On("config", cfgHandler(bot.Settings)).Desc("Print this server's settings.").Options()
+		config.On("audit", cfgAuditHandler(bot.Settings)).
+			Desc("Print the most recent changes to this server's settings.").
+			Args(&router.Arg{Name: "n", Desc: "How many changes to print, 10 by default", Kind: router.ArgInt, Min: 1, Max: 25})
+
+		config.Require(internal.LevelAdmin.Permission())
+		config.On("set", cfgSetHandler(cfg, bot.Settings)).
+			Desc("Change one of this server's settings. `default` resets a setting. "+
+				"Owners can change the defaults of every server with `global`.").
+			Args(
+				&router.Arg{Name: "global", Desc: "Change the default of every server", Kind: router.ArgFlag},
+				&router.Arg{Name: "setting", Desc: "The setting to change", Kind: router.ArgEnum, Required: true, Choices: internal.SettingNames()},
+				&router.Arg{Name: "value", Desc: "The new value, or `default`", Kind: router.ArgString, Required: true},
+			)
+	})
+
+	prefix := bot.Route.On("prefix", prefixHandler(prefixes)).Desc("Print the command prefixes of this server.").Options()
+	prefix.Group(func(r *router.Route) {
+		r.Require(internal.LevelAdmin.Permission())
+		r.On("set", prefixSetHandler(bot.Settings)).
+			Desc("Change this server's command prefix. `default` resets it.").
+			Args(&router.Arg{Name: "prefix", Desc: "The new prefix, ex. `!tb`, or `default`", Kind: router.ArgString, Required: true})
+	})
+
+	bot.Route.Group(func(r *router.Route) {
+		r.Require(internal.LevelAdmin.Permission())
+		r.On("pingdb", pingdbHandler(bot.Store)).Desc("Pings the database for a connection.").Options()
+	})
+
+	// Postgres has its own backup tools, only SQLite databases are backed up by the bot
+	var backups *internal.Backups
+	if dialect == internal.SQLite {
+		if backups, err = cfg.backups(); err != nil {
+			log.Fatal(err)
+		}
+	} else if cfg.BackupDir != "" || cfg.BackupInterval != "" {
+		log.Println("backups are only supported for SQLite databases, ignoring the backup settings")
+	}
+
+	admin := bot.Route.On("admin", nil).Desc("Bot maintenance.")
+	admin.Group(func(r *router.Route) {
+		r.Require(internal.LevelOwner.Permission())
+		r.On("backup", adminBackupHandler(backups)).Desc("Back up the database now.").Options()
+	})
+
+	// The options of slash commands which take a build
+	buildOptions := []*router.Option{
+		{Name: "char", Desc: "The character", Type: router.OptionString, Required: true, Complete: internal.BanChar.Complete},
+		{Name: "skin", Desc: "The character's skin", Type: router.OptionString, Required: true, Choices: []string{"a", "b"}},
+		{Name: "weapon", Desc: "The starting weapon", Type: router.OptionString, Required: true, Complete: internal.BanWeapon.Complete},
+		{Name: "crown", Desc: "The crown", Type: router.OptionString, Required: true, Complete: internal.BanCrown.Complete},
+		{Name: "mutations", Desc: "Starting mutations, separated by commas", Type: router.OptionString},
+		{Name: "ultra", Desc: "The ultra mutation", Type: router.OptionString, Complete: internal.BanUltra.Complete},
+	}
+
+	weekly := bot.Route.On("weekly", nil).Desc("Weekly suggestions, bans and settings.")
+	weekly.On("suggest", weeklySuggestionHandler(bot.Store, bot.Settings)).
+		Desc("Suggest a weekly. Ex. `steroids/b/grenade launcher/crown of death`, " +
+			"optionally with mutations and an ultra: `steroids/b/gl/death/rhino skin,euphoria/ambidextrous`").
+		Usage("thronebot weekly suggest char/skin/weapon/crown[/mutations[/ultra]]").
+		JoinOptions("/").
+		Options(buildOptions...)
+	weekly.On("banned", internal.GetBannedHandler(bot.Store)).Desc("Print banned selections.").Options()
+	weekly.On("history", internal.WeeklyHistoryHandler(bot.Store)).
+		Desc("Print the most recent weeklies.").
+		Args(&router.Arg{Name: "n", Desc: "How many weeklies to print, 5 by default", Kind: router.ArgInt, Min: 1, Max: 25})
+	weekly.Group(func(r *router.Route) {
+		r.Require(internal.LevelStaff.Permission())
+		r.On("ban", weeklyBanUnbanHandler(bot.Store)).
+			Desc("Ban or unban an item from the weekly, optionally for a duration like `2w` or `10d`.").
+			Args(
+				&router.Arg{Name: "action", Desc: "Ban or unban the item", Kind: router.ArgEnum, Required: true, Choices: []string{"add", "del"}},
+				&router.Arg{Name: "kind", Desc: "The kind of item", Kind: router.ArgEnum, Required: true, Choices: banKinds()},
+				&router.Arg{
+					Name:     "name",
+					Desc:     "The item, ex. `crown of blood`",
+					Kind:     router.ArgItem,
+					Required: true,
+					Parse:    internal.ParseBanItem,
+					Complete: internal.CompleteBanItem,
+				},
+				&router.Arg{Name: "duration", Desc: "How long the ban lasts, ex. `2w` or `10d`", Kind: router.ArgDuration},
+				&router.Arg{Name: "reason", Desc: "Why the item is banned", Kind: router.ArgRest, Prefix: "|"},
+			)
+		r.On("enable", weeklyEnableDisableHandler(tbClient, true)).Desc("Enable the weekly on Thronebutt.").Options()
+		r.On("disable", weeklyEnableDisableHandler(tbClient, false)).Desc("Disable the weekly on Thronebutt.").Options()
+		r.On("set", weeklySetHandler(bot.Store, tbClient)).
+			Desc("Set the weekly on Thronebutt from a build or a suggestion ID.").
+			Args(&router.Arg{
+				Name:     "build",
+				Desc:     "A build like `steroids/b/grenade launcher/crown of death` without mutations or an ultra, or a suggestion ID",
+				Kind:     router.ArgRest,
+				Required: true,
+			})
+	})
+
+	var archiver *internal.Archiver
+	if cfg.ArchiveRepo != "" {
+		if archiver, err = cfg.archiver(bot.Ses, sec.GithubKey); err != nil {
+			log.Fatal(err)
+		}
+
+		archiver.NoticeChannel = func(guildID string) string {
+			gs, err := bot.Settings.Get(guildID)
+			if err != nil {
+				return ""
+			}
+			return gs.ArchiveChannel
+		}
+
+		bot.Route.Group(func(r *router.Route) {
+			r.Require(internal.LevelStaff.Permission())
+			r.On("archive", internal.ArchiveHandler(archiver)).
+				Desc("Archive the pinned messages of a channel to the archive repository as Markdown, HTML or JSON.").
+				Args(
+					&router.Arg{Name: "channel", Desc: "The channel to archive, this one by default", Kind: router.ArgChannel},
+					&router.Arg{Name: "format", Desc: "The format of the archive", Kind: router.ArgEnum, Prefix: "--format", Choices: archiveFormats()},
+				)
+		})
+	}
+
+	day, hour, minute, err := cfg.schedule()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheduler := &internal.Scheduler{
+		Store:    bot.Store,
+		Ses:      bot.Ses,
+		Day:      day,
+		Hour:     hour,
+		Minute:   minute,
+		Channels: func() []string { return bot.Settings.Channels("voting_channel") },
+	}
+
+	if err = scheduler.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	defer scheduler.Stop()
+
+	sweeper := &internal.BanSweeper{
+		Store:    bot.Store,
+		Ses:      bot.Ses,
+		Channels: func() []string { return bot.Settings.Channels("staff_channel") },
+	}
+
+	sweeper.Start()
+	defer sweeper.Stop()
+
+	if backups != nil {
+		backups.Start()
+		defer backups.Stop()
+	}
+
+	stopWatching := watchConfig(*configPath, *reloadInterval, func(newCfg *config) {
+		cfgMu.Lock()
+		old := *cfg
+		*cfg = *newCfg
+		cfgMu.Unlock()
+
+		if old.DatabasePath != newCfg.DatabasePath || old.LogPath != newCfg.LogPath || old.GameDataPath != newCfg.GameDataPath {
+			log.Println("reload: database_path, log_path and game_data_path only take effect after a restart")
+		}
+
+		bot.Settings.SetDefaults(newCfg.guildDefaults())
+		setPermissions(newCfg)
+
+		if day, hour, minute, err := newCfg.schedule(); err != nil {
+			log.Println("reload: keeping the old weekly schedule:", err)
+		} else if err = scheduler.SetSchedule(day, hour, minute); err != nil {
+			log.Println("reload: failed to change the weekly schedule:", err)
+		}
 
-	bot.Route.On("pingdb", pingdbHandler(bot.DB)).Use(internal.ElevatedUser).Desc("Pings the database for a connection.")
+		log.Println("reload: applied config from", *configPath)
+	})
 
-	bot.Route.On("weekly", nil).
-		On("suggest", weeklySuggestionHandler(bot.DB)).
-		Desc("Suggest a weekly. Ex. `steroids/b/grenade launcher/crown of death`").
-		On("banned", internal.GetBannedHandler(bot.DB)).Desc("Print banned selections.").
-		// TODO
-		On("ban", weeklyBanUnbanHandler(bot.DB)).Use(internal.ElevatedUser).
-		On("enable", weeklyEnableDisableHandler(tbClient, true)).Use(internal.ElevatedUser).
-		On("disable", weeklyEnableDisableHandler(tbClient, false)).Use(internal.ElevatedUser).
-		On("set", nil).Use(internal.ElevatedUser)
+	defer close(stopWatching)
 
-	if *githubAPIKey != "" {
-		// TODO register archiving routes
+	if err = ses.Open(); err != nil {
+		log.Fatal(err)
 	}
 
 	var botID = ses.State.User.ID
 
 	bot.Ses.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		bot.Route.FindAndExecute(s, "thronebot", botID, m.Message)
+		bot.Route.FindAndExecute(s, prefixes, botID, m.Message)
+	})
+
+	// discordgo doesn't know about interactions, so slash commands are read from the raw gateway events
+	bot.Ses.AddHandler(func(s *discordgo.Session, e *discordgo.Event) {
+		if e.Type != "INTERACTION_CREATE" {
+			return
+		}
+
+		if err := bot.Route.HandleInteraction(s, e.RawData); err != nil {
+			log.Println("interaction:", err)
+		}
 	})
 
+	// The bot's user ID is also its application ID
+	if err = bot.Route.RegisterCommands(ses, botID); err != nil {
+		log.Println("failed to register slash commands:", err)
+	}
+
+	if archiver != nil {
+		bot.Ses.AddHandler(archiver.PinsUpdateHandler())
+	}
+
+	bot.Ses.AddHandler(internal.VoteAddHandler(bot.Store))
+	bot.Ses.AddHandler(internal.VoteRemoveHandler(bot.Store))
+
 	closer := make(chan os.Signal, 1)
 	signal.Notify(closer, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 
 	fmt.Println("Bot is running. Ctrl+C to quit.")
 	<-closer
+}
 
-	f, err := os.Open(*configPath)
-	if err != nil {
-		log.Println("failed to open config file:", err)
-		os.Exit(1)
-	}
+func weeklyBanUnbanHandler(store internal.WeeklyStore) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		addel := ctx.Values.String("action")
+		kind := internal.BanKind(ctx.Values.String("kind"))
+		which, reason := ctx.Values.String("name"), ctx.Values.String("reason")
+		val := kind.Items().NameToID(which)
+
+		// An optional duration makes the ban temporary
+		var expires time.Time
+		if d := ctx.Values.Duration("duration"); d > 0 {
+			expires = time.Now().Add(d)
+		}
 
-	err = json.NewEncoder(f).Encode(cfg)
-	if err != nil {
-		log.Println("failed to save config to file:", err)
-		os.Exit(1)
+		switch addel {
+		case "add":
+			err := store.AddBan(&internal.Ban{
+				Kind:     kind,
+				ItemID:   val,
+				Reason:   reason,
+				BannedBy: ctx.Msg.Author.ID,
+				Created:  time.Now(),
+				Expires:  expires,
+			})
+			if err != nil {
+				log.Println("weeklyBan:", err)
+				ctx.Reply("Failed to ban item.")
+				return
+			}
+
+			if expires.IsZero() {
+				ctx.Reply("Banned ", kind, " ", which)
+			} else {
+				ctx.Reply("Banned ", kind, " ", which, " until ", expires.UTC().Format("2006-01-02 15:04"), " UTC")
+			}
+		case "del":
+			ok, err := store.DelBan(kind, val)
+			if err != nil {
+				log.Println("weeklyBan:", err)
+				ctx.Reply("Failed to unban item.")
+				return
+			}
+
+			if !ok {
+				ctx.Reply(kind, " ", which, " isn't banned")
+				return
+			}
+			ctx.Reply("Unbanned ", kind, " ", which)
+		}
 	}
 }
 
-func weeklyBanUnbanHandler(db *sql.DB) router.HandlerFunc {
+func cfgHandler(settings *internal.Settings) router.HandlerFunc {
 	return func(ctx *router.Context) {
-		if len(ctx.Args) < 3 {
-			ctx.Reply(
-				"Usage: `thronebot weekly ban [add|del] [crown|char|wep] (name)`\n",
-				"To ban an item: ex: `thronebot weekly ban add crown crown of blood\n",
-				"To unban an item: ex: `thronebot weekly ban del char steroids",
-			)
+		guildID := ctx.GuildID()
+		gs, err := settings.Get(guildID)
+		if err != nil {
+			ctx.Reply("Failed to retrieve settings.")
 			return
 		}
 
-		addel := ctx.Args.Get(0)
-		kind := ctx.Args.Get(1)
-		which := ctx.Args.After(2)
-		var err error
-		var val int
+		title := "Default settings"
+		if g, err := ctx.Guild(guildID); err == nil {
+			title = "Settings for " + g.Name
+		}
+
+		embed := gs.Embed(title)
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "Change a setting with `" + gs.Prefix + " config set (name) (value)`"}
+		ctx.ReplyEmbed(embed)
+	}
+}
+
+func prefixHandler(prefixes router.PrefixResolver) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		var quoted []string
+		for _, p := range prefixes.Prefixes(ctx.GuildID()) {
+			quoted = append(quoted, "`"+p+"`")
+		}
+		ctx.Reply("Commands start with ", strings.Join(quoted, " or "), ", or a mention of the bot.")
+	}
+}
 
-		switch kind {
-		case "char":
-			val = internal.Chars.NameToID(which)
-		case "crown":
-			val = internal.Crowns.NameToID(which)
-		case "wep":
-			val = internal.Weapons.NameToID(which)
-		default:
-			ctx.Reply("Invalid option: ", which)
+func prefixSetHandler(settings *internal.Settings) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		val := ctx.Values.String("prefix")
+		guildID := ctx.GuildID()
+		if guildID == "" {
+			ctx.Reply("The prefix can only be changed in a server.")
 			return
 		}
 
-		if val == -1 {
-			ctx.Reply("Invalid selection: ", which)
+		if err := settings.Set(guildID, "prefix", val, ctx.Msg.Author.ID); err != nil {
+			ctx.Reply("Failed to set the prefix: ", err)
 			return
 		}
 
-		switch addel {
-		case "add":
-			err = internal.WeeklyBanAdd(db, kind, val)
-		case "del":
-			err = internal.WeeklyBanDel(db, kind, val)
-		default:
-			ctx.Reply("Invalid option: ", addel, "\n Expected `add` or `del`")
+		gs, err := settings.Get(guildID)
+		if err != nil {
+			ctx.Reply("Set the prefix to ", val)
 			return
 		}
+		ctx.Reply("Commands in this server now start with `", gs.Prefix, "`, ex. `", gs.Prefix, " help`")
+	}
+}
 
+func cfgAuditHandler(settings *internal.Settings) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		entries, err := settings.GetAudit(ctx.GuildID(), ctx.Values.Int("n", 10))
 		if err != nil {
-			ctx.Reply("Failed to ban item: ", err)
+			ctx.Reply("Failed to retrieve the audit log.")
+			return
 		}
+
+		if len(entries) == 0 {
+			ctx.Reply("No settings have been changed yet.")
+			return
+		}
+
+		var buf strings.Builder
+		for _, e := range entries {
+			scope := ""
+			if e.GuildID == internal.AuditGlobal {
+				scope = " (global)"
+			}
+			fmt.Fprintf(&buf, "`%s` <@%s> changed **%s**%s from %s to %s\n",
+				e.ChangedAt.Format("2006-01-02 15:04"), e.ChangedBy, e.Setting, scope, e.Old, e.New)
+		}
+
+		ctx.ReplyEmbed(&discordgo.MessageEmbed{
+			Title:       "Recent settings changes",
+			Description: buf.String(),
+		})
 	}
 }
 
-func cfgSetHandler(cfg *config) router.HandlerFunc {
+func cfgSetHandler(cfg *config, settings *internal.Settings) router.HandlerFunc {
 	return func(ctx *router.Context) {
-		prop, val := ctx.Args.Get(0), ctx.Args.Get(1)
-		if prop == "" || val == "" {
-			ctx.Reply("Missing property name or value")
+		global := ctx.Values.Bool("global")
+		prop, val := ctx.Values.String("setting"), ctx.Values.String("value")
+
+		guildID := ctx.GuildID()
+		if guildID == "" {
+			ctx.Reply("Settings can only be changed in a server.")
+			return
+		}
+
+		if err := internal.ValidateSetting(ctx, guildID, prop, val); err != nil {
+			ctx.Reply("Failed to set ", prop, ": ", err)
+			return
+		}
+
+		if !global {
+			if err := settings.Set(guildID, prop, val, ctx.Msg.Author.ID); err != nil {
+				ctx.Reply("Failed to set ", prop, ": ", err)
+				return
+			}
+
+			ctx.Reply("Set ", prop, " to ", val)
+			return
+		}
+
+		if internal.LevelOf(ctx) < internal.LevelOwner {
+			ctx.Reply("Only bot owners can change the global defaults.")
+			return
+		}
+
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+
+		defaults, err := settings.SetDefault(prop, val, ctx.Msg.Author.ID)
+		if err != nil {
+			ctx.Reply("Failed to set ", prop, ": ", err)
 			return
 		}
 
-		switch prop {
-		case "weekly_suggestion":
-			cfg.WeeklySuggestion = val
-		case "weekly_voting":
-			cfg.WeeklyVoting = val
-		case "staff":
-			cfg.Staff = val
-		default:
-			ctx.Reply("Invalid property name")
+		cfg.setGuildDefaults(defaults)
+		if err = cfg.save(*configPath); err != nil {
+			log.Println("cfgSet: failed to save config:", err)
+			ctx.Reply("Set the default ", prop, " to ", val, ", but failed to save the config file. The change will be lost on restart.")
 			return
 		}
-		log.Println("cfgSet: set property '", prop, "' to value '", val, "'")
-		ctx.Reply("Set ", prop, " to, ", val)
+
+		ctx.Reply("Set the default ", prop, " to ", val)
 	}
 }
 
@@ -226,62 +570,189 @@ func weeklyEnableDisableHandler(tbc *tbapi.Client, enable bool) router.HandlerFu
 			res, err = tbc.DisableWeekly()
 		}
 
-		defer res.Body.Close()
 		if err != nil {
 			log.Println("weeklyEnableDisable: error enabling/disabling weekly:", err)
+			ctx.Reply("Failed to reach Thronebutt: ", err)
+			return
 		}
+
+		defer res.Body.Close()
 		ctx.Reply("Got response:", res.Status)
 	}
 }
 
-func pingdbHandler(db *sql.DB) router.HandlerFunc {
+func weeklySetHandler(store internal.WeeklyStore, tbc *tbapi.Client) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		arg := ctx.Values.String("build")
+
+		var build *internal.Build
+		if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			s, err := store.Suggestion(id)
+			if err != nil {
+				log.Println("weeklySet:", err)
+				ctx.Reply("Failed to retrieve suggestion.")
+				return
+			}
+
+			if s == nil {
+				ctx.Reply("No suggestion with ID ", id)
+				return
+			}
+
+			build = &s.Build
+		} else {
+			build, err = internal.ParseBuild(arg)
+			if err != nil {
+				ctx.Reply(err)
+				return
+			}
+		}
+
+		// Thronebutt only takes the character, skin, weapon and crown of a weekly
+		if len(build.Mutations) > 0 || build.Ultra != "" {
+			ctx.Reply("Thronebutt weeklies can't have starting mutations or an ultra. Set `", build.Char, "/", strings.ToLower(build.SkinName()), "/", build.Weap, "/", build.Crown, "` instead?")
+			return
+		}
+
+		banned, err := store.IsBanned(build, time.Now())
+		if err != nil {
+			log.Println("weeklySet:", err)
+			ctx.Reply("Error while checking for banned items.")
+			return
+		}
+
+		if banned {
+			ctx.Reply("One or more of the selections in `", build, "` are currently banned.")
+			return
+		}
+
+		skin := 0
+		if build.Skin {
+			skin = 1
+		}
+
+		res, err := tbc.SetWeekly(
+			internal.Chars.NameToID(build.Char),
+			skin,
+			internal.Weapons.NameToID(build.Weap),
+			internal.Crowns.NameToID(build.Crown),
+		)
+		if err != nil {
+			log.Println("weeklySet: error setting weekly:", err)
+			ctx.Reply("Failed to set the weekly: ", err)
+			return
+		}
+
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			ctx.Reply("Thronebutt rejected the weekly: ", res.Status)
+			return
+		}
+
+		if err = store.InsertHistory(build, ctx.Msg.Author.ID, time.Now()); err != nil {
+			log.Println("weeklySet:", err)
+			ctx.Reply("Weekly set to `", build, "`, but it could not be saved to the history.")
+			return
+		}
+
+		ctx.Reply("Weekly set to `", build, "`")
+	}
+}
+
+func pingdbHandler(store internal.WeeklyStore) router.HandlerFunc {
 	return func(ctx *router.Context) {
-		res := db.Ping()
-		if res == driver.ErrBadConn {
-			log.Println("bot: bad DB conn:", res)
+		err := store.Ping()
+		if err == driver.ErrBadConn {
+			log.Println("bot: bad DB conn:", err)
 		}
-		ctx.Reply(res.Error())
+
+		if err != nil {
+			ctx.Reply(err.Error())
+			return
+		}
+		ctx.Reply("Pong")
+	}
+}
+
+// banKinds returns the names of the kinds of bannable items
+func banKinds() []string {
+	var res []string
+	for _, k := range internal.BanKinds {
+		res = append(res, string(k))
 	}
+	return res
 }
 
-func weeklySuggestionHandler(db *sql.DB) router.HandlerFunc {
+// archiveFormats returns the names of the archive formats
+func archiveFormats() []string {
+	var res []string
+	for _, f := range internal.ArchiveFormats {
+		res = append(res, string(f))
+	}
+	return res
+}
+
+func adminBackupHandler(backups *internal.Backups) router.HandlerFunc {
 	return func(ctx *router.Context) {
-		suggestCount := internal.GetUserSuggestionCount(db, ctx.Msg.Author.ID)
-		if suggestCount >= 3 {
-			ctx.Reply("You've already made 3 suggestions this week.")
+		if backups == nil {
+			ctx.Reply("Backups are only supported for SQLite databases.")
 			return
 		}
 
-		build := strings.Split(strings.ToLower(ctx.Args.Get(0)), "/")
-		if len(build) < 4 {
-			ctx.Reply(ctx.Msg.Author.Mention(), "Too few arguments")
+		name, err := backups.Snapshot()
+		if err != nil {
+			log.Println("adminBackup:", err)
+			if name == "" {
+				ctx.Reply("Failed to back up the database.")
+				return
+			}
+			ctx.Reply("Saved `", name, "`, but failed to remove old backups.")
 			return
 		}
 
-		var (
-			char  = build[0]
-			skin  = build[1] == "b"
-			weap  = build[2]
-			crown = build[3]
-		)
+		ctx.Reply("Saved `", name, "`")
+	}
+}
 
-		if _, ok := internal.Chars[char]; !ok {
-			ctx.Reply("Invalid character")
+func weeklySuggestionHandler(store internal.WeeklyStore, settings *internal.Settings) router.HandlerFunc {
+	return func(ctx *router.Context) {
+		gs, err := settings.Get(ctx.GuildID())
+		if err != nil {
+			ctx.Reply("Failed to retrieve settings.")
 			return
 		}
 
-		if _, ok := internal.Weapons[weap]; !ok {
-			ctx.Reply("Invalid weapon")
+		if gs.SuggestionChannel != "" && ctx.Msg.ChannelID != gs.SuggestionChannel {
+			ctx.Reply("Weekly suggestions go in <#", gs.SuggestionChannel, ">.")
 			return
 		}
 
-		if _, ok := internal.Crowns[crown]; !ok {
-			ctx.Reply("Invalid crown")
+		if gs.SuggestionLimit == 0 {
+			ctx.Reply("Weekly suggestions are disabled in this server.")
 			return
 		}
 
-		somethingBanned, err := internal.IsBanned(db, build[0], build[2], build[3])
+		suggestCount, err := store.SuggestionCount(ctx.Msg.Author.ID)
 		if err != nil {
+			log.Println("weeklySuggestion:", err)
+			ctx.Reply("Failed to retrieve your suggestion count.")
+			return
+		}
+
+		if suggestCount >= gs.SuggestionLimit {
+			ctx.Reply("You've already made ", gs.SuggestionLimit, " suggestions this week.")
+			return
+		}
+
+		build, err := internal.ParseBuild(ctx.Args.After(1))
+		if err != nil {
+			ctx.Reply(ctx.Msg.Author.Mention(), " ", err)
+			return
+		}
+
+		somethingBanned, err := store.IsBanned(build, time.Now())
+		if err != nil {
+			log.Println("weeklySuggestion:", err)
 			ctx.Reply("Error while checking for banned items.")
 			return
 		}
@@ -291,11 +762,47 @@ func weeklySuggestionHandler(db *sql.DB) router.HandlerFunc {
 			return
 		}
 
-		err = internal.InsertSuggestion(db, ctx.Msg.Author.ID, char, weap, crown, skin)
+		if gs.WeeklyCooldown > 0 {
+			last, err := store.LastPlayed(build)
+			if err != nil {
+				log.Println("weeklySuggestion:", err)
+				ctx.Reply("Error while checking previous weeklies.")
+				return
+			}
+
+			if !last.IsZero() && time.Since(last) < time.Duration(gs.WeeklyCooldown)*7*24*time.Hour {
+				ctx.Reply(
+					"That character, weapon and crown combination was last played on ", last.Format("2006-01-02"),
+					". Combinations can't be repeated within ", gs.WeeklyCooldown, " weeks.",
+				)
+				return
+			}
+		}
+
+		id, err := store.InsertSuggestion(ctx.Msg.Author.ID, build)
 		if err != nil {
+			log.Println("weeklySuggestion:", err)
 			ctx.Reply("Failed to save suggestion.")
-		} else {
-			// TODO post to weekly voting channel
+			return
+		}
+
+		if gs.VotingChannel == "" {
+			ctx.Reply("Suggestion saved, but no voting channel is configured.")
+			return
+		}
+
+		msg, err := internal.PostSuggestion(ctx.Ses, gs.VotingChannel, id, ctx.Msg.Author, build)
+		if err != nil {
+			ctx.Reply("Suggestion saved, but it could not be posted for voting.")
+			return
 		}
+
+		if err = store.SetSuggestionMessage(id, msg.ID); err != nil {
+			log.Println("weeklySuggestion:", err)
+			ctx.Reply("Suggestion posted, but votes on it won't be counted.")
+			return
+		}
+
+		ctx.Reply("Suggestion posted in <#", gs.VotingChannel, ">.")
 	}
 }
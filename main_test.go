@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Krognol/tbapi"
+	"github.com/Krognol/thronebot/internal"
+	"github.com/Krognol/thronebot/internal/router"
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeAPI stands in for Discord and Thronebutt. Requests to a discord host are answered like the
+// Discord REST API, everything else like Thronebutt with tbStatus.
+type fakeAPI struct {
+	mu       sync.Mutex
+	sent     []sentMessage
+	tbCalls  int
+	tbStatus int
+}
+
+// sentMessage is a message sent to Discord. Text is the content, or the title and description of an embed.
+type sentMessage struct {
+	ID, ChannelID, Text string
+}
+
+// newFakeAPI starts a fakeAPI and routes every request made through http.DefaultTransport to it
+// until the test ends
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{tbStatus: http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(srv.Close)
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := http.DefaultTransport
+	http.DefaultTransport = &redirectTransport{target: target, next: orig}
+	t.Cleanup(func() { http.DefaultTransport = orig })
+	return api
+}
+
+func (a *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !strings.Contains(r.Host, "discord") {
+		a.tbCalls++
+		w.WriteHeader(a.tbStatus)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/messages"):
+		var m discordgo.MessageSend
+		json.NewDecoder(r.Body).Decode(&m)
+
+		sent := sentMessage{ID: fmt.Sprint("m", len(a.sent)+1), ChannelID: parts[len(parts)-2], Text: m.Content}
+		if m.Embed != nil {
+			sent.Text = strings.TrimSpace(m.Embed.Title + "\n" + m.Embed.Description)
+		}
+		a.sent = append(a.sent, sent)
+		fmt.Fprintf(w, `{"id":%q,"channel_id":%q}`, sent.ID, sent.ChannelID)
+	case r.Method == http.MethodGet && len(parts) > 1 && parts[len(parts)-2] == "channels":
+		fmt.Fprintf(w, `{"id":%q,"guild_id":"g1"}`, parts[len(parts)-1])
+	default:
+		w.Write([]byte("{}"))
+	}
+}
+
+// messages returns the messages sent to channelID so far
+func (a *fakeAPI) messages(channelID string) []sentMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var res []sentMessage
+	for _, m := range a.sent {
+		if m.ChannelID == channelID {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// lastReply returns the text of the last message sent to c1, where test commands are sent
+func (a *fakeAPI) lastReply(t *testing.T) string {
+	t.Helper()
+	r := a.messages("c1")
+	if len(r) == 0 {
+		t.Fatal("no reply was sent")
+	}
+	return r[len(r)-1].Text
+}
+
+// thronebuttCalls returns how many requests Thronebutt received
+func (a *fakeAPI) thronebuttCalls() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.tbCalls
+}
+
+// redirectTransport sends every request to target, keeping the original host in the Host header
+type redirectTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+	return rt.next.RoundTrip(r)
+}
+
+// newTestContext returns a context for a message sent by u1 in channel c1 of guild g1
+func newTestContext(t *testing.T, values router.Values, args ...string) *router.Context {
+	ses, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &discordgo.Message{
+		ID:        "m0",
+		ChannelID: "c1",
+		GuildID:   "g1",
+		Content:   strings.Join(args, " "),
+		Author:    &discordgo.User{ID: "u1", Username: "tester", Discriminator: "0001"},
+	}
+
+	ctx := router.NewContext(ses, msg, router.Args(args), nil)
+	ctx.Values = values
+	return ctx
+}
+
+func TestWeeklySet(t *testing.T) {
+	cases := []struct {
+		name     string
+		build    string
+		ban      *internal.Ban
+		tbStatus int
+
+		reply   string
+		tbCalls int
+		history string
+	}{
+		{
+			name:    "literal build",
+			build:   "fish/b/revolver/death",
+			reply:   "Weekly set to `fish/b/revolver/death`",
+			tbCalls: 1,
+			history: "fish/b/revolver/death",
+		},
+		{
+			name:    "suggestion id",
+			build:   "1",
+			reply:   "Weekly set to `crystal/a/revolver/life`",
+			tbCalls: 1,
+			history: "crystal/a/revolver/life",
+		},
+		{
+			name:  "literal build with mutations",
+			build: "fish/b/revolver/death/rhino skin",
+			reply: "can't have starting mutations or an ultra",
+		},
+		{
+			name:  "suggestion id with an ultra",
+			build: "2",
+			reply: "Set `fish/a/revolver/life` instead?",
+		},
+		{
+			name:  "unknown suggestion id",
+			build: "42",
+			reply: "No suggestion with ID 42",
+		},
+		{
+			name:  "banned item",
+			build: "fish/b/revolver/death",
+			ban:   &internal.Ban{Kind: internal.BanCrown, ItemID: internal.Crowns.NameToID("death")},
+			reply: "are currently banned",
+		},
+		{
+			name:     "thronebutt rejects",
+			build:    "fish/b/revolver/death",
+			tbStatus: http.StatusInternalServerError,
+			reply:    "Thronebutt rejected the weekly: 500 Internal Server Error",
+			tbCalls:  1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			if c.tbStatus != 0 {
+				api.tbStatus = c.tbStatus
+			}
+
+			store := internal.NewMemoryStore()
+			if _, err := store.InsertSuggestion("u2", &internal.Build{Char: "crystal", Weap: "revolver", Crown: "life"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.InsertSuggestion("u3", &internal.Build{Char: "fish", Weap: "revolver", Crown: "life", Ultra: "confiscate"}); err != nil {
+				t.Fatal(err)
+			}
+			if c.ban != nil {
+				if err := store.AddBan(c.ban); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := newTestContext(t, router.Values{"build": c.build})
+			weeklySetHandler(store, tbapi.New("key"))(ctx)
+
+			if reply := api.lastReply(t); !strings.Contains(reply, c.reply) {
+				t.Errorf("reply = %q, want it to contain %q", reply, c.reply)
+			}
+			if n := api.thronebuttCalls(); n != c.tbCalls {
+				t.Errorf("thronebutt got %d requests, want %d", n, c.tbCalls)
+			}
+
+			history, err := store.History(10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case c.history == "" && len(history) != 0:
+				t.Errorf("history = %v, want it empty", history)
+			case c.history != "" && (len(history) != 1 || history[0].Build.String() != c.history):
+				t.Errorf("history = %v, want one entry for %s", history, c.history)
+			}
+		})
+	}
+}
+
+// newTestSettings returns settings with the defaults, stored in a new SQLite database
+func newTestSettings(t *testing.T, defaults internal.GuildSettings) *internal.Settings {
+	db, err := internal.OpenDB("sqlite3", filepath.Join(t.TempDir(), "thronebot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err = internal.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return internal.NewSettings(db, defaults)
+}
+
+func TestWeeklySuggestion(t *testing.T) {
+	const build = "fish/b/revolver/death"
+
+	cases := []struct {
+		name     string
+		limit    int
+		cooldown int
+		// suggested is how many suggestions u1 made before
+		suggested int
+		// played is how long ago the build was last the weekly, if it was
+		played time.Duration
+		ban    *internal.Ban
+
+		reply  string
+		posted bool
+	}{
+		{
+			name:   "posted",
+			limit:  2,
+			reply:  "Suggestion posted in <#c2>.",
+			posted: true,
+		},
+		{
+			name:      "limit reached",
+			limit:     2,
+			suggested: 2,
+			reply:     "You've already made 2 suggestions this week.",
+		},
+		{
+			name:  "suggestions disabled",
+			limit: 0,
+			reply: "Weekly suggestions are disabled in this server.",
+		},
+		{
+			name:     "played within the cooldown",
+			limit:    2,
+			cooldown: 4,
+			played:   7 * 24 * time.Hour,
+			reply:    "Combinations can't be repeated within 4 weeks.",
+		},
+		{
+			name:     "played before the cooldown",
+			limit:    2,
+			cooldown: 4,
+			played:   5 * 7 * 24 * time.Hour,
+			reply:    "Suggestion posted in <#c2>.",
+			posted:   true,
+		},
+		{
+			name:  "banned item",
+			limit: 2,
+			ban:   &internal.Ban{Kind: internal.BanWeapon, ItemID: internal.Weapons.NameToID("revolver")},
+			reply: "One or more of your selections are currently banned.",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			settings := newTestSettings(t, internal.GuildSettings{
+				VotingChannel:   "c2",
+				SuggestionLimit: c.limit,
+				WeeklyCooldown:  c.cooldown,
+			})
+
+			store := internal.NewMemoryStore()
+			for i := 0; i < c.suggested; i++ {
+				if _, err := store.InsertSuggestion("u1", &internal.Build{Char: "crystal", Weap: "revolver", Crown: "life"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.played != 0 {
+				b, _ := internal.ParseBuild(build)
+				if err := store.InsertHistory(b, "u2", time.Now().Add(-c.played)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.ban != nil {
+				if err := store.AddBan(c.ban); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := newTestContext(t, nil, "suggest", build)
+			weeklySuggestionHandler(store, settings)(ctx)
+
+			if reply := api.lastReply(t); !strings.Contains(reply, c.reply) {
+				t.Errorf("reply = %q, want it to contain %q", reply, c.reply)
+			}
+
+			suggestions, err := store.Suggestions()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			posts := api.messages("c2")
+			if !c.posted {
+				if len(suggestions) != c.suggested || len(posts) != 0 {
+					t.Errorf("got %d suggestions and %d voting posts, want %d and none", len(suggestions), len(posts), c.suggested)
+				}
+				return
+			}
+
+			if len(suggestions) != c.suggested+1 || len(posts) != 1 {
+				t.Fatalf("got %d suggestions and %d voting posts, want %d and 1", len(suggestions), len(posts), c.suggested+1)
+			}
+
+			s := suggestions[0]
+			if s.UserID != "u1" || s.Build.String() != build {
+				t.Errorf("saved %s by %s, want %s by u1", &s.Build, s.UserID, build)
+			}
+			if want := fmt.Sprint("Weekly suggestion #", s.ID); posts[0].Text != want {
+				t.Errorf("voting post = %q, want %q", posts[0].Text, want)
+			}
+
+			// Votes on the post count towards the suggestion
+			if err = store.UpdateVotes(posts[0].ID, true, 1); err != nil {
+				t.Fatal(err)
+			}
+			if s, _ = store.Suggestion(s.ID); s.Up != 1 {
+				t.Errorf("suggestion has %d upvotes after voting on its post, want 1", s.Up)
+			}
+		})
+	}
+}
+
+func TestWeeklyBan(t *testing.T) {
+	api := newFakeAPI(t)
+	store := internal.NewMemoryStore()
+	death := internal.Crowns.NameToID("death")
+
+	steps := []struct {
+		values router.Values
+		reply  string
+		// bans are the crowns banned afterwards, with whether the ban expires
+		bans map[int]bool
+	}{
+		{
+			values: router.Values{"action": "del", "kind": "crown", "name": "death"},
+			reply:  "crown death isn't banned",
+		},
+		{
+			values: router.Values{"action": "add", "kind": "crown", "name": "death", "reason": "too easy"},
+			reply:  "Banned crown death",
+			bans:   map[int]bool{death: false},
+		},
+		{
+			values: router.Values{"action": "add", "kind": "crown", "name": "blood", "duration": 48 * time.Hour},
+			reply:  "Banned crown blood until ",
+			bans:   map[int]bool{death: false, internal.Crowns.NameToID("blood"): true},
+		},
+		{
+			values: router.Values{"action": "del", "kind": "crown", "name": "death"},
+			reply:  "Unbanned crown death",
+			bans:   map[int]bool{internal.Crowns.NameToID("blood"): true},
+		},
+	}
+
+	for i, step := range steps {
+		weeklyBanUnbanHandler(store)(newTestContext(t, step.values))
+
+		if reply := api.lastReply(t); !strings.HasPrefix(reply, step.reply) {
+			t.Errorf("step %d: reply = %q, want it to start with %q", i, reply, step.reply)
+		}
+
+		bans, err := store.Bans(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bans) != len(step.bans) {
+			t.Errorf("step %d: got %d bans, want %d", i, len(bans), len(step.bans))
+		}
+		for _, b := range bans {
+			expires, ok := step.bans[b.ItemID]
+			switch {
+			case b.Kind != internal.BanCrown || !ok:
+				t.Errorf("step %d: unexpected ban of %s %s", i, b.Kind, b.Name())
+			case b.BannedBy != "u1":
+				t.Errorf("step %d: %s was banned by %q, want u1", i, b.Name(), b.BannedBy)
+			case expires != !b.Expires.IsZero():
+				t.Errorf("step %d: %s expires at %v", i, b.Name(), b.Expires)
+			}
+		}
+	}
+}